@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"16/xkcd"
+)
+
+func main() {
+	format := flag.String("format", "text", "report as text or json")
+	out := flag.String("o", "", "also write the comics normalized to this file")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "no file given")
+		os.Exit(-1)
+	}
+
+	file := flag.Arg(0)
+
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, expected text or json\n", *format)
+		os.Exit(-1)
+	}
+
+	report, err := xkcd.Validate(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bad file: %s\n", err)
+		os.Exit(-1)
+	}
+
+	if *out != "" {
+		if err := normalize(file, *out); err != nil {
+			fmt.Fprintf(os.Stderr, "can't normalize: %s\n", err)
+			os.Exit(-1)
+		}
+	}
+
+	if err := report.Write(os.Stdout, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(-1)
+	}
+
+	// like diff, 1 means there's something to look at
+	if len(report.Problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+// normalize writes each comic whose date makes sense in its tidied
+// form, in the format the name of the file asks for
+func normalize(in, out string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := xkcd.NewWriter(f, xkcd.FormatOf(out))
+
+	err = xkcd.Scan(in, func(num int, data json.RawMessage) error {
+		var c xkcd.Comic
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil // in the report already
+		}
+
+		n, err := c.Normalize()
+		if err != nil {
+			return nil
+		}
+
+		data, err = json.Marshal(n)
+		if err != nil {
+			return err
+		}
+
+		return w.Write(data)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"16/xkcd"
+	"16/xkcdtest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8081", "address to listen on")
+	latency := flag.Duration("latency", 0, "how long every response takes")
+	jitter := flag.Duration("jitter", 0, "up to this much more, at random")
+	errorRate := flag.Float64("errors", 0, "share of requests that fail with a 500, 0 to 1")
+	cutRate := flag.Float64("cut", 0, "share of responses cut off half way, 0 to 1")
+	missing := flag.String("missing", "", "comics to 404, e.g. 5,100-120")
+	rate := flag.Float64("rate", 0, "requests a second before answering 429, 0 for no limit")
+	burst := flag.Int("burst", 10, "with -rate, requests allowed at once")
+	seed := flag.Uint64("seed", 1, "seed for the random failures and delays")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatal("no file given")
+	}
+
+	comics, err := xkcd.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := xkcdtest.New(comics)
+	s.Latency, s.Jitter = *latency, *jitter
+	s.ErrorRate, s.CutRate = *errorRate, *cutRate
+	s.Rate, s.Burst = *rate, *burst
+	s.Seed(*seed)
+
+	if s.Missing, err = parseNums(*missing); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("serving %d comics on %s, try xkcd-load -base http://%s", len(comics), *addr, *addr)
+	log.Fatal(http.ListenAndServe(*addr, logged(s)))
+}
+
+// parseNums reads a list of numbers and ranges like 5,100-120
+func parseNums(s string) (map[int]bool, error) {
+	nums := make(map[int]bool)
+
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err1 := strconv.Atoi(lo)
+		to, err2 := from, error(nil)
+		if isRange {
+			to, err2 = strconv.Atoi(hi)
+		}
+
+		if err1 != nil || err2 != nil || to < from {
+			return nil, fmt.Errorf("bad comic or range %q", part)
+		}
+
+		for n := from; n <= to; n++ {
+			nums[n] = true
+		}
+	}
+
+	return nums, nil
+}
+
+type recorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logged logs each request with its status and how long it took
+func logged(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &recorder{w, http.StatusOK}
+
+		h.ServeHTTP(rec, r)
+		log.Printf("%d %s %s", rec.status, r.URL.Path, time.Since(start).Round(time.Millisecond))
+	})
+}
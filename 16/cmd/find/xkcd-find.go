@@ -1,84 +1,88 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"os"
 	"strings"
-)
 
-type cartoon struct {
-	Month      string `json:"month"`
-	Num        int    `json:"num"`
-	Link       string `json:"link"`
-	Year       string `json:"year"`
-	News       string `json:"news"`
-	SafeTitle  string `json:"safe_title"`
-	Transcript string `json:"transcript"`
-	Alt        string `json:"alt"`
-	Img        string `json:"img"`
-	Title      string `json:"title"`
-	Day        string `json:"day"`
-}
+	"16/search"
+)
 
 func main() {
-	if len(os.Args) < 2 {
+	limit := flag.Int("n", 0, "show at most this many comics, 0 for all")
+	scores := flag.Bool("scores", false, "show the score of each comic")
+	fuzzy := flag.Bool("fuzzy", false, "let every word match words a letter or two off")
+	boostTitle := flag.Float64("boost-title", search.DefaultBoosts[search.Title], "weight of a match in the title")
+	boostAlt := flag.Float64("boost-alt", search.DefaultBoosts[search.Alt], "weight of a match in the alt text")
+	boostTranscript := flag.Float64("boost-transcript", search.DefaultBoosts[search.Transcript], "weight of a match in the transcript")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		fmt.Fprintln(os.Stderr, "no file given")
 		os.Exit(-1)
 	}
 
-	fileName := os.Args[1]
+	fileName := flag.Arg(0)
 
-	if len(os.Args) < 3 {
+	if flag.NArg() < 2 {
 		fmt.Fprintln(os.Stderr, "no search term")
 		os.Exit(0)
 	}
 
-	var (
-		items []cartoon
-		terms []string
-		input io.ReadCloser
-		count int
-		err   error
-	)
-
-	if input, err = os.Open(fileName); err != nil {
+	// the index is kept next to the file and updated when it grows
+	index, err := search.Open(fileName)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "bad file: %s\n", err)
 		os.Exit(-1)
 	}
 
-	// decode file
-	if err = json.NewDecoder(input).Decode(&items); err != nil {
-		fmt.Fprintf(os.Stderr, "bad json: %s\n", err)
-		os.Exit(-1)
+	fmt.Fprintf(os.Stderr, "indexed %d comics\n", len(index.Docs))
+
+	boosts := search.Boosts{*boostTitle, *boostAlt, *boostTranscript}
+	query := strings.Join(flag.Args()[1:], " ")
+
+	lookup := index.Search
+	if *fuzzy {
+		lookup = index.SearchFuzzy
+	}
+
+	hits, err := lookup(query, boosts)
+	if err != nil {
+		var pe *search.ParseError
+		if errors.As(err, &pe) {
+			fmt.Fprintf(os.Stderr, "bad query:\n%s\n", pe.Show(query))
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
 	}
 
-	fmt.Fprintf(os.Stderr, "read %d comics\n", len(items))
+	found := len(hits)
 
-	// get search terms
-	for _, t := range os.Args[2:] {
-		terms = append(terms, strings.ToLower(t))
+	if *limit > 0 && len(hits) > *limit {
+		hits = hits[:*limit]
 	}
 
-	// search
-cartoons:
-	for _, item := range items {
-		title := strings.ToLower(item.Title)
-		transcript := strings.ToLower(item.Transcript)
+	for _, h := range hits {
+		d := h.Doc
 
-		for _, term := range terms {
-			if !strings.Contains(title, term) && !strings.Contains(transcript, term) {
-				continue cartoons
-			}
+		if *scores {
+			fmt.Printf("%6.2f ", h.Score)
 		}
 
 		fmt.Printf(
 			"https://xkcd.com/%d/ %s/%s/%s %q\n",
-			item.Num, item.Month, item.Day, item.Year, item.Title,
+			d.Num, d.Month, d.Day, d.Year, d.Title,
 		)
-		count++
 	}
 
-	fmt.Fprintf(os.Stderr, "found %d comics\n", count)
+	fmt.Fprintf(os.Stderr, "found %d comics\n", found)
+
+	if found == 0 {
+		if s := index.Suggest(query); s != "" {
+			fmt.Fprintf(os.Stderr, "did you mean: %s\n", s)
+		}
+	}
 }
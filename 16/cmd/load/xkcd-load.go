@@ -1,84 +1,251 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"16/xkcd"
 )
 
-// returns the metadata for one comic by number
-func getOne(i int) []byte {
-	url := fmt.Sprintf("https://xkcd.com/%d/info.0.json", i)
-	response, err := http.Get(url)
+type options struct {
+	base    string
+	workers int
+	retries int
+	backoff time.Duration
+	images  string
+	verify  bool
+}
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "can't read: %s\n", err)
-		os.Exit(-1)
+func main() {
+	var o options
+	flag.StringVar(&o.base, "base", xkcd.DefaultBaseURL, "where to fetch the comics from, e.g. a fake server")
+	flag.IntVar(&o.workers, "workers", 8, "comics to fetch at a time")
+	flag.IntVar(&o.retries, "retries", 4, "extra attempts after a network error, 429 or 5xx")
+	flag.DurationVar(&o.backoff, "backoff", 500*time.Millisecond, "how long to wait before the first retry, doubled after each")
+	flag.StringVar(&o.images, "images", "", "mirror the images into this directory")
+	flag.BoolVar(&o.verify, "verify", false, "with -images, check the contents of the images we have, not just their sizes")
+	flag.Parse()
+
+	if o.workers < 1 {
+		fmt.Fprintln(os.Stderr, "-workers must be at least 1")
+		os.Exit(2)
 	}
 
-	defer response.Body.Close()
+	// Ctrl-C stops fetching but keeps what we have, for next time
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
 
-	if response.StatusCode != http.StatusOK {
-		fmt.Fprintf(os.Stderr, "skipping %d: got %d\n", i, response.StatusCode)
-		return nil
+	os.Exit(load(ctx, o, flag.Arg(0), os.Stdout, os.Stderr))
+}
+
+// load brings the file up to date, or writes all the comics to stdout
+// without one, and returns the exit code: 1 if some are still missing.
+// The comics are streamed from the file we had to the new one, with
+// those we fetch added on the end, so only their numbers are kept in
+// memory however many there are.
+func load(ctx context.Context, o options, file string, stdout, stderr io.Writer) int {
+	client := xkcd.NewClient()
+	client.BaseURL = o.base
+	client.Retries = o.retries
+	client.Backoff = o.backoff
+
+	// without a file we build one to copy to stdout, in its format
+	out := file
+	if file == "" {
+		dir, err := os.MkdirTemp("", "xkcd-load-")
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return -1
+		}
+		defer os.RemoveAll(dir)
+
+		out = filepath.Join(dir, "comics.json")
 	}
 
-	body, err := io.ReadAll(response.Body)
+	// with a file we only fetch what it doesn't have yet
+	have := make(map[int]bool)
+
+	err := xkcd.Scan(out, func(num int, _ json.RawMessage) error {
+		have[num] = true
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return -1
+	}
 
+	latest, err := client.Latest(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "invalid body: %s\n", err)
-		os.Exit(-1)
+		fmt.Fprintf(stderr, "can't find the latest comic: %s\n", err)
+		return -1
 	}
 
-	return body
-}
+	todo := xkcd.Missing(have, latest)
+	fmt.Fprintf(stderr, "have %d comics, latest is %d, fetching %d\n", len(have), latest, len(todo))
 
-func main() {
-	var (
-		output io.WriteCloser = os.Stdout
-		err    error
-		count  int
-		fails  int
-		data   []byte
-	)
+	var count, failed int
 
-	if len(os.Args) > 1 {
-		output, err = os.Create(os.Args[1])
+	err = xkcd.Replace(out, func(w io.Writer) error {
+		cw := xkcd.NewWriter(w, xkcd.FormatOf(out))
 
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(-1)
+		if err := xkcd.Scan(out, func(_ int, data json.RawMessage) error {
+			return cw.Write(data)
+		}); err != nil {
+			return err
 		}
 
-		defer output.Close()
+		// a failed write stops the fetching, but we still wait for the
+		// requests out to come back
+		fetchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var werr error
+
+		for r := range client.Fetch(fetchCtx, todo, o.workers) {
+			switch {
+			case werr != nil:
+			case errors.Is(r.Err, xkcd.ErrMissing):
+				fmt.Fprintf(stderr, "skipping %d: missing\n", r.Num)
+			case r.Err != nil:
+				if ctx.Err() == nil {
+					fmt.Fprintf(stderr, "failed %d: %s\n", r.Num, r.Err)
+				}
+				failed++
+			default:
+				if werr = cw.Write(r.Data); werr != nil {
+					cancel()
+					continue
+				}
+				have[r.Num] = true
+				count++
+			}
+		}
+
+		if werr != nil {
+			return werr
+		}
+		return cw.Close()
+	})
+
+	if err == nil && o.images != "" {
+		// paths are recorded relative to the comics file, so the two
+		// can be moved together
+		m := &xkcd.Mirror{Dir: o.images, Base: filepath.Dir(file), Verify: o.verify}
+
+		var n int
+		n, err = mirror(ctx, m, client, out, o.workers, stderr)
+		failed += n
 	}
 
-	fmt.Fprintln(output, "[")
-	defer fmt.Fprintln(output, "]")
+	if err == nil && file == "" {
+		err = copyFile(stdout, out)
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "stopped: %s\n", err)
+		return -1
+	}
+
+	fmt.Fprintf(stderr, "read %d comics, %d in all\n", count, len(have))
+
+	if ctx.Err() != nil || failed > 0 {
+		fmt.Fprintln(stderr, "incomplete, run again to fetch the rest")
+		return 1
+	}
+
+	return 0
+}
+
+// mirror brings the images up to date and records the new ones in the
+// file, returning how many it couldn't get
+func mirror(ctx context.Context, m *xkcd.Mirror, client *xkcd.Client, file string, workers int, stderr io.Writer) (int, error) {
+	var fetched, repaired, failed int
+	images := make(map[int]*xkcd.Image)
+
+	var err error
+	comics := func(yield func(int, json.RawMessage) bool) {
+		err = xkcd.Scan(file, func(num int, data json.RawMessage) error {
+			if !yield(num, data) {
+				return errStop
+			}
+			return nil
+		})
+		if err == errStop {
+			err = nil
+		}
+	}
 
-	// stop if we get 2 404s in a row
-	for i := 1; fails < 2; i++ {
-		if data = getOne(i); data == nil {
-			fails++
-			continue
+	for r := range m.Sync(ctx, client, comics, workers) {
+		if r.Broken != nil && ctx.Err() == nil {
+			fmt.Fprintf(stderr, "repairing %d: %s\n", r.Num, r.Broken)
 		}
 
-		if count > 0 {
-			fmt.Fprint(output, ",")
+		switch {
+		case errors.Is(r.Err, xkcd.ErrMissing):
+			fmt.Fprintf(stderr, "no image for %d\n", r.Num)
+		case r.Err != nil:
+			if ctx.Err() == nil {
+				fmt.Fprintf(stderr, "failed image %d: %s\n", r.Num, r.Err)
+			}
+			failed++
+		case r.Image != nil:
+			images[r.Num] = r.Image
+			fetched++
+			if r.Broken != nil {
+				repaired++
+			}
 		}
+	}
+
+	// Sync read the file before it returned
+	if err != nil {
+		return failed, err
+	}
 
-		_, err = io.Copy(output, bytes.NewBuffer(data))
+	fmt.Fprintf(stderr, "fetched %d images (%d repaired) into %s\n", fetched, repaired, m.Dir)
 
+	if len(images) == 0 {
+		return failed, nil
+	}
+
+	return failed, xkcd.Replace(file, func(w io.Writer) error {
+		cw := xkcd.NewWriter(w, xkcd.FormatOf(file))
+
+		err := xkcd.Scan(file, func(num int, data json.RawMessage) error {
+			if img := images[num]; img != nil {
+				var err error
+				if data, err = xkcd.SetImage(data, img); err != nil {
+					return fmt.Errorf("%d: %w", num, err)
+				}
+			}
+			return cw.Write(data)
+		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "stopped: %s\n", err)
-			os.Exit(-1)
+			return err
 		}
 
-		fails = 0
-		count++
+		return cw.Close()
+	})
+}
+
+// errStop ends a Scan early
+var errStop = errors.New("stop")
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
 
-	fmt.Fprintf(os.Stderr, "read %d commics\n", count)
+	_, err = io.Copy(w, f)
+	return err
 }
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"16/xkcd"
+	"16/xkcdtest"
+)
+
+func fixture() map[int]json.RawMessage {
+	comics := make(map[int]json.RawMessage)
+	for n := 1; n <= 40; n++ {
+		comics[n] = json.RawMessage(fmt.Sprintf(`{"num": %d, "title": "comic %d"}`, n, n))
+	}
+	return comics
+}
+
+func TestLoad(t *testing.T) {
+	fake := xkcdtest.New(fixture())
+	fake.Latency, fake.Jitter = time.Millisecond, 2*time.Millisecond
+	fake.ErrorRate, fake.CutRate = 0.2, 0.1
+	fake.Missing = map[int]bool{7: true}
+
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	o := options{base: srv.URL, workers: 4, retries: 10, backoff: time.Millisecond}
+	file := filepath.Join(t.TempDir(), "comics.ndjson")
+
+	var stderr bytes.Buffer
+	if code := load(context.Background(), o, file, nil, &stderr); code != 0 {
+		t.Fatalf("exit %d:\n%s", code, stderr.String())
+	}
+
+	have, err := xkcd.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := slices.DeleteFunc(slices.Collect(maps.Keys(fixture())), func(n int) bool { return n == 7 })
+	slices.Sort(want)
+
+	if got := slices.Sorted(maps.Keys(have)); !slices.Equal(got, want) {
+		t.Errorf("expected all but 7, got %v", got)
+	}
+
+	if !strings.Contains(stderr.String(), "skipping 7: missing") {
+		t.Errorf("7 not reported missing:\n%s", stderr.String())
+	}
+
+	// the second time there's only 7 left to ask for
+	before := fake.Requests("")
+	fake.ErrorRate, fake.CutRate = 0, 0
+
+	if code := load(context.Background(), o, file, nil, &stderr); code != 0 {
+		t.Fatalf("exit %d:\n%s", code, stderr.String())
+	}
+
+	if n := fake.Requests("") - before; n != 2 {
+		t.Errorf("expected the latest and 7 to be asked for, got %d requests", n)
+	}
+}
+
+func TestLoadIncomplete(t *testing.T) {
+	fake := xkcdtest.New(fixture())
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	o := options{base: srv.URL, workers: 4, retries: 1, backoff: time.Millisecond}
+
+	var stdout, stderr bytes.Buffer
+	if code := load(context.Background(), o, "", &stdout, &stderr); code != 0 {
+		t.Fatalf("exit %d:\n%s", code, stderr.String())
+	}
+
+	// everything fails now, but what we had is kept
+	file := filepath.Join(t.TempDir(), "comics.json")
+	have := fixture()
+	delete(have, 20)
+	delete(have, 21)
+	if err := xkcd.WriteFile(file, have); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.ErrorRate = 1
+	if code := load(context.Background(), o, file, nil, &stderr); code != -1 {
+		t.Errorf("expected -1 without the latest, got %d", code)
+	}
+
+	// the latest gets through, the rest are turned away and not tried
+	// again, as the server wants us to wait a long while
+	fake.Rate, fake.Burst, fake.ErrorRate = 0.001, 1, 0
+	o.retries = 0
+	stderr.Reset()
+
+	if code := load(context.Background(), o, file, nil, &stderr); code != 1 {
+		t.Errorf("expected 1 for an incomplete load, got %d:\n%s", code, stderr.String())
+	}
+
+	back, err := xkcd.ReadFile(file)
+	if err != nil || len(back) != 38 {
+		t.Errorf("expected the 38 comics kept, got %d: %v", len(back), err)
+	}
+
+	var all []json.RawMessage
+	if err := json.Unmarshal(stdout.Bytes(), &all); err != nil || len(all) != 40 {
+		t.Errorf("expected 40 comics on stdout, got %d: %v", len(all), err)
+	}
+}
+
+func TestLoadImages(t *testing.T) {
+	var pic bytes.Buffer
+	png.Encode(&pic, image.NewGray(image.Rect(0, 0, 3, 2)))
+
+	pics := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pic.Bytes())
+	}))
+	defer pics.Close()
+
+	comics := fixture()
+	for n := 1; n <= 10; n++ {
+		comics[n] = json.RawMessage(fmt.Sprintf(`{"num": %d, "img": "%s/%d.png"}`, n, pics.URL, n))
+	}
+
+	srv := httptest.NewServer(xkcdtest.New(comics))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "comics.json.gz")
+	o := options{base: srv.URL, workers: 4, backoff: time.Millisecond, images: filepath.Join(dir, "images")}
+
+	var stderr bytes.Buffer
+	if code := load(context.Background(), o, file, nil, &stderr); code != 0 {
+		t.Fatalf("exit %d:\n%s", code, stderr.String())
+	}
+
+	have, err := xkcd.ReadFile(file)
+	if err != nil || len(have) != 40 {
+		t.Fatalf("expected 40 comics, got %d: %v", len(have), err)
+	}
+
+	all, err := xkcd.Decode(have)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range all {
+		if (c.Local != nil) != (c.Num <= 10) {
+			t.Errorf("%d: unexpected image %+v", c.Num, c.Local)
+		}
+	}
+
+	// the copies check out, so the second time nothing changes
+	stderr.Reset()
+	if code := load(context.Background(), o, file, nil, &stderr); code != 0 {
+		t.Fatalf("exit %d:\n%s", code, stderr.String())
+	}
+
+	if !strings.Contains(stderr.String(), "fetched 0 images") {
+		t.Errorf("expected nothing fetched:\n%s", stderr.String())
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"16/search"
+	"16/xkcd"
+)
+
+// the longest snippet we show of a field
+const snippetWidth = 160
+
+type server struct {
+	index  *search.Index
+	comics map[int]*xkcd.Comic
+	nums   []int  // in order, for random picks and prev/next
+	base   string // the directory of comics.json, for mirrored images
+	boosts search.Boosts
+}
+
+// hit is one search result as the API returns it
+type hit struct {
+	Num      int                       `json:"num"`
+	Title    string                    `json:"title"`
+	Date     string                    `json:"date"`
+	URL      string                    `json:"url"`
+	Img      string                    `json:"img"`
+	Score    float64                   `json:"score"`
+	Snippets map[string]search.Snippet `json:"snippets"`
+}
+
+type results struct {
+	Query      string `json:"query"`
+	Fuzzy      bool   `json:"fuzzy,omitempty"`
+	Total      int    `json:"total"`
+	Hits       []hit  `json:"hits"`
+	Suggestion string `json:"suggestion,omitempty"` // when nothing matched
+}
+
+type apiError struct {
+	Error string `json:"error"`
+	Pos   *int   `json:"pos,omitempty"` // where a query went wrong
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatal("no file given")
+	}
+
+	s, err := newServer(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("serving %d comics on %s", len(s.comics), *addr)
+	log.Fatal(http.ListenAndServe(*addr, s.routes()))
+}
+
+func newServer(file string) (*server, error) {
+	index, err := search.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := xkcd.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := xkcd.Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &server{
+		index:  index,
+		comics: make(map[int]*xkcd.Comic),
+		base:   filepath.Dir(file),
+		boosts: search.DefaultBoosts,
+	}
+
+	for i := range all {
+		s.comics[all[i].Num] = &all[i]
+		s.nums = append(s.nums, all[i].Num)
+	}
+
+	return s, nil
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /{$}", s.searchPage)
+	mux.HandleFunc("GET /comic/{num}", s.comicPage)
+	mux.HandleFunc("GET /random", s.random)
+	mux.HandleFunc("GET /api/search", s.apiSearch)
+	mux.HandleFunc("GET /api/comic/{num}", s.apiComic)
+	mux.HandleFunc("GET /api/random", s.apiRandom)
+	mux.HandleFunc("GET /image/{num}", s.image)
+
+	return mux
+}
+
+// search runs the query from the request; n and offset page through
+// the hits
+func (s *server) search(r *http.Request) (results, error) {
+	q := r.URL.Query()
+	res := results{Query: q.Get("q"), Fuzzy: q.Get("fuzzy") != ""}
+
+	n, err := strconv.Atoi(q.Get("n"))
+	if err != nil || n <= 0 || n > 100 {
+		n = 20
+	}
+
+	offset, err := strconv.Atoi(q.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	lookup := s.index.Search
+	if res.Fuzzy {
+		lookup = s.index.SearchFuzzy
+	}
+
+	hits, err := lookup(res.Query, s.boosts)
+	if err != nil {
+		return res, err
+	}
+
+	res.Total = len(hits)
+	if res.Total == 0 {
+		res.Suggestion = s.index.Suggest(res.Query)
+	}
+	hits = hits[min(offset, len(hits)):min(offset+n, len(hits))]
+
+	var terms [search.NumFields][]string
+	for f := range search.NumFields {
+		terms[f] = s.index.HighlightTerms(res.Query, f, res.Fuzzy)
+	}
+
+	for _, h := range hits {
+		c := s.comics[h.Doc.Num]
+		out := hit{
+			Num:      c.Num,
+			Title:    c.Title,
+			Date:     date(c),
+			URL:      c.URL(),
+			Img:      c.Img,
+			Score:    h.Score,
+			Snippets: make(map[string]search.Snippet),
+		}
+
+		for f, text := range [search.NumFields]string{c.Title, c.Alt, c.Transcript} {
+			if sn := search.MakeSnippet(text, terms[f], snippetWidth); len(sn.Highlights) > 0 {
+				out.Snippets[search.Field(f).String()] = sn
+			}
+		}
+
+		res.Hits = append(res.Hits, out)
+	}
+
+	return res, nil
+}
+
+func (s *server) apiSearch(w http.ResponseWriter, r *http.Request) {
+	res, err := s.search(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *server) apiComic(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.comic(r)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "no such comic"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *server) apiRandom(w http.ResponseWriter, r *http.Request) {
+	num, ok := s.pick()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "no comics"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.comics[num])
+}
+
+func (s *server) random(w http.ResponseWriter, r *http.Request) {
+	num, ok := s.pick()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the page changes every time, so don't let it be cached
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, fmt.Sprintf("/comic/%d", num), http.StatusFound)
+}
+
+// image serves the mirrored copy of a comic's image if the loader
+// made one under the comics file's directory, and sends the browser to
+// xkcd.com if not
+func (s *server) image(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.comic(r)
+	switch {
+	case !ok || c.Img == "":
+		http.NotFound(w, r)
+	case c.Local == nil || !filepath.IsLocal(filepath.FromSlash(c.Local.Path)):
+		// a mirror outside the comics file's directory could point
+		// anywhere on the machine, so we don't serve from it
+		http.Redirect(w, r, c.Img, http.StatusFound)
+	default:
+		http.ServeFile(w, r, filepath.Join(s.base, filepath.FromSlash(c.Local.Path)))
+	}
+}
+
+// pick is a random comic, if there are any
+func (s *server) pick() (int, bool) {
+	if len(s.nums) == 0 {
+		return 0, false
+	}
+	return s.nums[rand.IntN(len(s.nums))], true
+}
+
+func (s *server) comic(r *http.Request) (*xkcd.Comic, bool) {
+	num, err := strconv.Atoi(r.PathValue("num"))
+	if err != nil {
+		return nil, false
+	}
+
+	c, ok := s.comics[num]
+	return c, ok
+}
+
+func (s *server) searchPage(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		results
+		Error string
+	}{}
+
+	res, err := s.search(r)
+	data.results = res
+	status := http.StatusOK
+
+	if err != nil {
+		var pe *search.ParseError
+		if errors.As(err, &pe) {
+			data.Error = pe.Show(res.Query)
+		} else {
+			data.Error = err.Error()
+		}
+		status = http.StatusBadRequest
+	}
+
+	render(w, status, searchTmpl, data)
+}
+
+func (s *server) comicPage(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.comic(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := struct {
+		*xkcd.Comic
+		Date       string
+		Query      string // the search box is empty here
+		Fuzzy      bool
+		Prev, Next int
+	}{Comic: c, Date: date(c)}
+
+	for i, n := range s.nums {
+		if n == c.Num {
+			if i > 0 {
+				data.Prev = s.nums[i-1]
+			}
+			if i < len(s.nums)-1 {
+				data.Next = s.nums[i+1]
+			}
+			break
+		}
+	}
+
+	render(w, http.StatusOK, comicTmpl, data)
+}
+
+// date is empty for the odd comic whose date makes no sense
+func date(c *xkcd.Comic) string {
+	d, err := c.Date()
+	if err != nil {
+		return ""
+	}
+	return d.Format(time.DateOnly)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var pe *search.ParseError
+	if errors.As(err, &pe) {
+		writeJSON(w, http.StatusBadRequest, apiError{pe.Msg, &pe.Pos})
+		return
+	}
+
+	writeJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"16/xkcd"
+)
+
+func testServer(t *testing.T) *httptest.Server {
+	return serve(t, map[int]json.RawMessage{
+		1: json.RawMessage(`{"num": 1, "title": "Beds", "year": "2006", "month": "1", "day": "1", "alt": "<b>comfy</b> beds", "img": "https://imgs.xkcd.com/comics/beds.png"}`),
+		2: json.RawMessage(`{"num": 2, "title": "Sleep", "year": "2007", "month": "3", "day": "14", "transcript": "She is sleeping in her bed."}`),
+		3: json.RawMessage(`{"num": 3, "title": "Compiler", "year": "2008", "month": "12", "day": "25"}`),
+	})
+}
+
+// serve runs the server on a file with these comics
+func serve(t *testing.T, comics map[int]json.RawMessage) *httptest.Server {
+	file := filepath.Join(t.TempDir(), "comics.json")
+	if err := xkcd.WriteFile(file, comics); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newServer(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func get(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, string(body)
+}
+
+func TestAPISearch(t *testing.T) {
+	ts := testServer(t)
+
+	status, body := get(t, ts.URL+"/api/search?q=bed")
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", status, body)
+	}
+
+	var res results
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Total != 2 || len(res.Hits) != 2 || res.Hits[0].Num != 1 {
+		t.Fatalf("expected comics 1 and 2, got %+v", res)
+	}
+
+	if h := res.Hits[0]; h.Date != "2006-01-01" || h.Snippets["title"].Text != "Beds" {
+		t.Errorf("unexpected hit %+v", h)
+	}
+
+	sn := res.Hits[1].Snippets["transcript"]
+	if len(sn.Highlights) != 1 || sn.Text[sn.Highlights[0][0]:sn.Highlights[0][1]] != "bed" {
+		t.Errorf("expected bed highlighted, got %+v", sn)
+	}
+
+	status, body = get(t, ts.URL+"/api/search?q=bed+OR")
+	if status != http.StatusBadRequest || !strings.Contains(body, `"pos": 4`) {
+		t.Errorf("expected a parse error at 4, got %d: %s", status, body)
+	}
+}
+
+func TestPages(t *testing.T) {
+	ts := testServer(t)
+
+	status, body := get(t, ts.URL+"/?q=comfy")
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+
+	// the alt text is escaped but the highlight isn't
+	if !strings.Contains(body, "&lt;b&gt;<mark>comfy</mark>&lt;/b&gt; beds") {
+		t.Errorf("no highlighted snippet in %s", body)
+	}
+
+	status, body = get(t, ts.URL+"/comic/2")
+	if status != http.StatusOK || !strings.Contains(body, "She is sleeping in her bed.") ||
+		!strings.Contains(body, `href="/comic/1"`) || !strings.Contains(body, `href="/comic/3"`) {
+		t.Errorf("unexpected comic page %d: %s", status, body)
+	}
+
+	if status, _ := get(t, ts.URL+"/image/3"); status != http.StatusNotFound {
+		t.Errorf("expected 404 for a comic with no image, got %d", status)
+	}
+
+	if status, _ := get(t, ts.URL+"/comic/404"); status != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing comic, got %d", status)
+	}
+
+	// following the redirect lands on some comic's page
+	if status, body := get(t, ts.URL+"/random"); status != http.StatusOK || !strings.Contains(body, "<h1>#") {
+		t.Errorf("unexpected random page %d: %s", status, body)
+	}
+}
+
+func TestImage(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "comics.json")
+	os.MkdirAll(filepath.Join(dir, "images"), 0o755)
+	os.WriteFile(filepath.Join(dir, "images", "beds.png"), []byte("png"), 0o644)
+
+	err := xkcd.WriteFile(file, map[int]json.RawMessage{
+		1: json.RawMessage(`{"num": 1, "img": "https://imgs.xkcd.com/comics/beds.png", "local_img": {"path": "images/beds.png"}}`),
+		2: json.RawMessage(`{"num": 2, "img": "https://imgs.xkcd.com/comics/sleep.png", "local_img": {"path": "../../etc/passwd"}}`),
+		3: json.RawMessage(`{"num": 3, "img": "https://imgs.xkcd.com/comics/compiler.png", "local_img": {"path": "/etc/passwd"}}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newServer(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	if status, body := get(t, ts.URL+"/image/1"); status != http.StatusOK || body != "png" {
+		t.Errorf("expected the mirrored image, got %d: %s", status, body)
+	}
+
+	// paths out of the directory go to xkcd.com instead
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	for _, num := range []string{"2", "3"} {
+		resp, err := client.Get(ts.URL + "/image/" + num)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusFound || !strings.HasPrefix(resp.Header.Get("Location"), "https://imgs.xkcd.com/") {
+			t.Errorf("image %s: expected a redirect, got %d", num, resp.StatusCode)
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	ts := serve(t, map[int]json.RawMessage{})
+
+	for _, path := range []string{"/random", "/api/random", "/api/comic/1"} {
+		if code, body := get(t, ts.URL+path); code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d %s", path, code, body)
+		}
+	}
+
+	if code, _ := get(t, ts.URL+"/api/search?q=bed"); code != http.StatusOK {
+		t.Errorf("expected a search to find nothing, got %d", code)
+	}
+}
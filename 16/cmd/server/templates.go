@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"16/search"
+)
+
+var funcs = template.FuncMap{
+	// mark wraps the highlighted words of a snippet in <mark>,
+	// escaping everything else
+	"mark": func(s search.Snippet) template.HTML {
+		var b strings.Builder
+		last := 0
+
+		for _, h := range s.Highlights {
+			b.WriteString(template.HTMLEscapeString(s.Text[last:h[0]]))
+			b.WriteString("<mark>")
+			b.WriteString(template.HTMLEscapeString(s.Text[h[0]:h[1]]))
+			b.WriteString("</mark>")
+			last = h[1]
+		}
+
+		b.WriteString(template.HTMLEscapeString(s.Text[last:]))
+		return template.HTML(b.String())
+	},
+}
+
+const layout = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{block "title" .}}xkcd search{{end}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; }
+input[type=search] { width: 70%; }
+li { margin-bottom: 1em; list-style: none; }
+.meta { color: #666; font-size: small; }
+.error { white-space: pre; font-family: monospace; color: #a00; }
+mark { background: #ff6; }
+</style>
+</head>
+<body>
+<form action="/">
+<input type="search" name="q" value="{{.Query}}" autofocus placeholder="velociraptor OR title:&quot;bobby tables&quot;">
+<button>Search</button> <label><input type="checkbox" name="fuzzy" value="1"{{if .Fuzzy}} checked{{end}}> typos</label>
+<a href="/random">Random</a>
+</form>
+{{template "content" .}}
+</body>
+</html>
+`
+
+var searchTmpl = template.Must(template.Must(template.New("search").Funcs(funcs).Parse(layout)).Parse(`
+{{define "title"}}{{if .Query}}{{.Query}} - {{end}}xkcd search{{end}}
+{{define "content"}}
+{{if .Error}}<p class="error">{{.Error}}</p>
+{{else if .Query}}<p class="meta">{{.Total}} comics</p>
+{{with .Suggestion}}<p>Did you mean <a href="/?q={{.}}">{{.}}</a>?</p>{{end}}
+<ul>
+{{range .Hits}}<li>
+<a href="/comic/{{.Num}}">#{{.Num}} {{.Title}}</a> <span class="meta">{{.Date}}</span>
+{{range $field, $s := .Snippets}}<div><span class="meta">{{$field}}:</span> {{mark $s}}</div>
+{{end}}</li>
+{{end}}</ul>
+{{end}}
+{{end}}
+`))
+
+var comicTmpl = template.Must(template.Must(template.New("comic").Funcs(funcs).Parse(layout)).Parse(`
+{{define "title"}}#{{.Num}} {{.Title}}{{end}}
+{{define "content"}}
+<h1>#{{.Num}} {{.Title}}</h1>
+<p class="meta">{{.Date}} · <a href="{{.URL}}">xkcd.com</a>
+{{if .Prev}}· <a href="/comic/{{.Prev}}">previous</a>{{end}}
+{{if .Next}}· <a href="/comic/{{.Next}}">next</a>{{end}}</p>
+{{if .Img}}<img src="/image/{{.Num}}" alt="{{.Title}}" title="{{.Alt}}">{{end}}
+<p>{{.Alt}}</p>
+{{if .Transcript}}<pre>{{.Transcript}}</pre>{{end}}
+{{end}}
+`))
+
+// render executes the template first, so a failure is a 500 rather
+// than half a page
+func render(w http.ResponseWriter, status int, t *template.Template, data any) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		log.Print(err)
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	b.WriteTo(w)
+}
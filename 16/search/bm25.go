@@ -0,0 +1,118 @@
+package search
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+)
+
+// BM25 parameters: k1 limits how much repeating a term helps, b how
+// much a long field is penalized
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Boosts weigh a match in each field; a word in the title says more
+// about a comic than one in the transcript
+type Boosts [NumFields]float64
+
+var DefaultBoosts = Boosts{Title: 3, Alt: 1.5, Transcript: 1}
+
+type Hit struct {
+	Doc   *Doc
+	Score float64
+}
+
+// Search returns the comics that match the query, best first; see
+// Parse for what a query can say. Comics matched only by a NOT or a
+// range all score 0, and come newest first.
+func (x *Index) Search(query string, boosts Boosts) ([]Hit, error) {
+	return x.search(query, boosts, false)
+}
+
+// SearchFuzzy is Search with every word taken as if it ended in ~, so
+// that typos still find something
+func (x *Index) SearchFuzzy(query string, boosts Boosts) ([]Hit, error) {
+	return x.search(query, boosts, true)
+}
+
+func (x *Index) search(query string, boosts Boosts, fuzz bool) ([]Hit, error) {
+	n, err := Parse(query)
+	if err != nil || n == nil {
+		return nil, err
+	}
+
+	if fuzz {
+		n = fuzzy(n)
+	}
+
+	var terms []termNode
+	scored(n, &terms)
+
+	slices.SortFunc(terms, func(a, b termNode) int {
+		return cmp.Or(strings.Compare(a.term, b.term), int(a.field-b.field))
+	})
+	terms = slices.Compact(terms)
+
+	scores := make(map[int]float64)
+	for _, t := range terms {
+		for num, s := range x.score(t.term, t.field, boosts) {
+			scores[num] += s
+		}
+	}
+
+	var near []fuzzyNode
+	fuzzies(n, &near)
+
+	for _, f := range slices.Compact(near) {
+		for num, s := range x.scoreNear(f, boosts) {
+			scores[num] += s
+		}
+	}
+
+	var hits []Hit
+	for num := range n.match(x) {
+		hits = append(hits, Hit{x.Docs[num], scores[num]})
+	}
+
+	sortHits(hits)
+	return hits, nil
+}
+
+// score gives the BM25 score of one term for each comic it appears in,
+// summed over the fields with their boosts, or just the one field
+func (x *Index) score(term string, field Field, boosts Boosts) map[int]float64 {
+	postings := x.Terms[term]
+	docs := make(map[int]bool)
+
+	for _, p := range postings {
+		docs[p.Num] = true
+	}
+
+	n, df := float64(len(x.Docs)), float64(len(docs))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+	out := make(map[int]float64)
+
+	for _, p := range postings {
+		if field != AnyField && p.Field != field {
+			continue
+		}
+
+		avg := float64(x.Total[p.Field]) / n
+		tf := float64(len(p.Pos))
+		norm := 1 - b + b*float64(x.Docs[p.Num].Len[p.Field])/avg
+
+		out[p.Num] += boosts[p.Field] * idf * tf * (k1 + 1) / (tf + k1*norm)
+	}
+
+	return out
+}
+
+// best first, then newest first
+func sortHits(hits []Hit) {
+	slices.SortFunc(hits, func(a, b Hit) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), b.Doc.Num-a.Doc.Num)
+	})
+}
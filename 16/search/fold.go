@@ -0,0 +1,52 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Fold lowercases text the way Unicode case folding does, so that
+// "STRASSE", "Straße" and "strasse" agree, and takes the accents off
+// letters, so "café" is "cafe". Only Latin letters have their marks
+// taken off; combining marks are dropped whatever they're on.
+func Fold(text string) string {
+	var b strings.Builder
+	b.Grow(len(text))
+
+	for _, r := range text {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		// going through upper case catches the letters with more
+		// than one lower case, like ς and σ
+		r = unicode.ToLower(unicode.ToUpper(r))
+
+		if s, ok := unaccented[r]; ok {
+			b.WriteString(s)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+var unaccented = func() map[rune]string {
+	m := make(map[rune]string)
+
+	for _, l := range [][2]string{
+		{"àáâãäåāăą", "a"}, {"çćĉċč", "c"}, {"ďđð", "d"}, {"èéêëēĕėęě", "e"},
+		{"ĝğġģ", "g"}, {"ĥħ", "h"}, {"ìíîïĩīĭįı", "i"}, {"ĵ", "j"}, {"ķ", "k"},
+		{"ĺļľŀł", "l"}, {"ñńņňŉ", "n"}, {"òóôõöøōŏő", "o"}, {"ŕŗř", "r"},
+		{"śŝşšſ", "s"}, {"ţťŧ", "t"}, {"ùúûüũūŭůűų", "u"}, {"ŵ", "w"},
+		{"ýÿŷ", "y"}, {"źżž", "z"},
+		{"ß", "ss"}, {"æ", "ae"}, {"œ", "oe"}, {"þ", "th"}, {"ĳ", "ij"},
+	} {
+		for _, r := range l[0] {
+			m[r] = l[1]
+		}
+	}
+
+	return m
+}()
@@ -0,0 +1,262 @@
+package search
+
+import (
+	"cmp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Auto is the fuzziness that depends on the length of the word: none
+// up to 2 letters, 1 edit up to 5 and 2 beyond that
+const Auto = -1
+
+// fuzzyNode is a word that also matches the indexed terms within dist
+// edits of it
+type fuzzyNode struct {
+	field Field
+	term  string
+	dist  int
+}
+
+func (n fuzzyNode) match(x *Index) map[int]bool {
+	return x.expand(n).match(x)
+}
+
+func autoDist(term string) int {
+	switch n := utf8.RuneCountInString(term); {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	}
+	return 2
+}
+
+type near struct {
+	term string
+	dist int
+}
+
+// near lists the indexed terms within dist edits of term, the term
+// itself included if we have it
+func (x *Index) near(term string, dist int) []near {
+	if dist == Auto {
+		dist = autoDist(term)
+	}
+
+	a := []rune(term)
+	var out []near
+
+	for t := range x.Terms {
+		// the lengths alone rule most of them out
+		if n := utf8.RuneCountInString(t) - len(a); n > dist || -n > dist {
+			continue
+		}
+
+		if d := distance(a, []rune(t), dist); d <= dist {
+			out = append(out, near{t, d})
+		}
+	}
+
+	return out
+}
+
+// closest is the indexed term nearest to term, the most common one if
+// there's a tie, or "" if none is near enough
+func (x *Index) closest(term string) string {
+	best := near{dist: -1}
+
+	for _, n := range x.near(term, Auto) {
+		if best.dist < 0 || cmp.Or(
+			cmp.Compare(n.dist, best.dist),
+			cmp.Compare(len(x.Terms[best.term]), len(x.Terms[n.term])),
+			strings.Compare(n.term, best.term),
+		) < 0 {
+			best = n
+		}
+	}
+
+	return best.term
+}
+
+// distance is the Levenshtein distance between a and b, or max+1 if
+// it's more than max, which lets it stop early
+func distance(a, b []rune, max int) int {
+	if len(a)-len(b) > max || len(b)-len(a) > max {
+		return max + 1
+	}
+
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		least := i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			least = min(least, cur[j])
+		}
+
+		// every way on from this row costs at least as much
+		if least > max {
+			return max + 1
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return min(prev[len(b)], max+1)
+}
+
+// fuzzy makes every word of a query fuzzy, but not those in phrases or
+// under a NOT, where a near miss would exclude too much
+func fuzzy(n node) node {
+	switch n := n.(type) {
+	case termNode:
+		return fuzzyNode{n.field, n.term, Auto}
+	case andNode:
+		out := make(andNode, len(n))
+		for i, kid := range n {
+			out[i] = fuzzy(kid)
+		}
+		return out
+	case orNode:
+		out := make(orNode, len(n))
+		for i, kid := range n {
+			out[i] = fuzzy(kid)
+		}
+		return out
+	}
+	return n
+}
+
+// expand replaces each fuzzy word with the terms near it
+func (x *Index) expand(n node) node {
+	switch n := n.(type) {
+	case fuzzyNode:
+		var out orNode
+		for _, m := range x.near(n.term, n.dist) {
+			out = append(out, termNode{n.field, m.term})
+		}
+		return out
+	case andNode:
+		out := make(andNode, len(n))
+		for i, kid := range n {
+			out[i] = x.expand(kid)
+		}
+		return out
+	case orNode:
+		out := make(orNode, len(n))
+		for i, kid := range n {
+			out[i] = x.expand(kid)
+		}
+		return out
+	case notNode:
+		return notNode{x.expand(n.n)}
+	}
+
+	return n
+}
+
+// fuzzies lists the fuzzy words that add to a comic's score, as
+// scored does the rest
+func fuzzies(n node, out *[]fuzzyNode) {
+	switch n := n.(type) {
+	case fuzzyNode:
+		*out = append(*out, n)
+	case andNode:
+		for _, kid := range n {
+			fuzzies(kid, out)
+		}
+	case orNode:
+		for _, kid := range n {
+			fuzzies(kid, out)
+		}
+	}
+}
+
+// scoreNear scores a fuzzy word by the best of the terms near it in
+// each comic, so that matching several near misses doesn't beat
+// matching the word itself; a near miss counts for less the more
+// edits it takes
+func (x *Index) scoreNear(n fuzzyNode, boosts Boosts) map[int]float64 {
+	out := make(map[int]float64)
+	size := float64(utf8.RuneCountInString(n.term))
+
+	for _, m := range x.near(n.term, n.dist) {
+		w := 1 - float64(m.dist)/(size+1)
+
+		for num, s := range x.score(m.term, n.field, boosts) {
+			out[num] = max(out[num], w*s)
+		}
+	}
+
+	return out
+}
+
+// Suggest offers the query with each word we have never seen replaced
+// by the nearest one we have, if that finds anything; "" if not
+func (x *Index) Suggest(query string) string {
+	toks, err := lex(query)
+	if err != nil {
+		return ""
+	}
+
+	type edit struct {
+		from, to int
+		word     string
+	}
+	var edits []edit
+
+	for i, t := range toks {
+		if i > 0 && toks[i-1].kind == tField && (toks[i-1].text == "num" || toks[i-1].text == "date") {
+			continue
+		}
+
+		start, text := t.pos, t.text
+		switch t.kind {
+		case tPhrase:
+			start++
+		case tWord:
+			text, _, _ = strings.Cut(text, "~")
+		default:
+			continue
+		}
+
+		for _, w := range words(text) {
+			word := normal(text[w[0]:w[1]])
+			if stopWords[word] || x.Terms[Stem(word)] != nil {
+				continue
+			}
+
+			if c := x.closest(Stem(word)); c != "" {
+				edits = append(edits, edit{start + w[0], start + w[1], x.Words[c]})
+			}
+		}
+	}
+
+	if len(edits) == 0 {
+		return ""
+	}
+
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		query = query[:e.from] + e.word + query[e.to:]
+	}
+
+	if hits, err := x.Search(query, DefaultBoosts); err != nil || len(hits) == 0 {
+		return ""
+	}
+
+	return query
+}
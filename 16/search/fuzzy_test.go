@@ -0,0 +1,112 @@
+package search
+
+import (
+	"slices"
+	"testing"
+
+	"16/xkcd"
+)
+
+func TestFold(t *testing.T) {
+	for in, want := range map[string]string{
+		"Café":       "cafe",
+		"STRASSE":    "strasse",
+		"Straße":     "strasse",
+		"Cafe\u0301": "cafe",
+		"ΣΟΦΟΣ":      "σοφοσ",
+		"σοφος":      "σοφοσ",
+		"Łódź":       "lodz",
+		"Ærøskøbing": "aeroskobing",
+	} {
+		if got := Fold(in); got != want {
+			t.Errorf("%q: expected %q, got %q", in, want, got)
+		}
+	}
+
+	if got := Terms("Ça, c'est un CAFÉ!"); !slices.Equal(got, []string{"ca", "cest", "un", "cafe"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	for _, st := range []struct {
+		a, b      string
+		max, want int
+	}{
+		{"velociraptor", "velocraptor", 2, 1},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 2, 3},
+		{"flaw", "lawn", 2, 2},
+		{"", "abc", 5, 3},
+		{"café", "cafe", 1, 1},
+		{"same", "same", 0, 0},
+		{"abcdef", "ab", 1, 2},
+	} {
+		if got := distance([]rune(st.a), []rune(st.b), st.max); got != st.want {
+			t.Errorf("%s %s within %d: expected %d, got %d", st.a, st.b, st.max, st.want, got)
+		}
+	}
+}
+
+func TestFuzzy(t *testing.T) {
+	x := New()
+	for _, c := range []xkcd.Comic{
+		{Num: 1, Title: "Velociraptors", Transcript: "A velociraptor attacks."},
+		{Num: 2, Title: "Raptor Fences", Transcript: "Velociraptors test the fences."},
+		{Num: 3, Title: "Sheep", Transcript: "A sheep asleep."},
+		{Num: 4, Title: "Sleep", Transcript: "Sleeping in bed."},
+		{Num: 5, Title: "Café", Alt: "Crème brûlée"},
+	} {
+		x.Add(&c)
+	}
+
+	nums := func(hits []Hit, err error) []int {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out []int
+		for _, h := range hits {
+			out = append(out, h.Doc.Num)
+		}
+		return out
+	}
+
+	if got := nums(x.Search("velocraptor", DefaultBoosts)); got != nil {
+		t.Errorf("expected no exact match, got %v", got)
+	}
+
+	if got := nums(x.Search("velocraptor~", DefaultBoosts)); !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("expected 1 and 2, got %v", got)
+	}
+
+	// sheep is a letter off sleep, but the real thing comes first
+	if got := nums(x.SearchFuzzy("sleep", DefaultBoosts)); !slices.Equal(got, []int{4, 3}) {
+		t.Errorf("expected 4 then 3, got %v", got)
+	}
+
+	if got := nums(x.Search("sleep~0", DefaultBoosts)); !slices.Equal(got, []int{4}) {
+		t.Errorf("expected only 4, got %v", got)
+	}
+
+	if got := nums(x.Search("CAFE creme brulee", DefaultBoosts)); !slices.Equal(got, []int{5}) {
+		t.Errorf("expected 5 without the accents, got %v", got)
+	}
+
+	for query, want := range map[string]string{
+		"velocraptor fences":    "velociraptor fences",
+		`title:"raptr fences"`:  `title:"raptor fences"`,
+		"velociraptor":          "",
+		"xylophone":             "",
+		"velocraptor num:1..10": "velociraptor num:1..10",
+	} {
+		if got := x.Suggest(query); got != want {
+			t.Errorf("%s: expected %q, got %q", query, want, got)
+		}
+	}
+
+	terms := x.HighlightTerms("velocraptor", Transcript, true)
+	if !slices.Equal(terms, []string{"velociraptor"}) {
+		t.Errorf("expected velociraptor to be highlighted, got %v", terms)
+	}
+}
@@ -0,0 +1,229 @@
+// Package search keeps an inverted index of the comics and ranks them
+// for a query with BM25.
+package search
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"16/xkcd"
+)
+
+// the fields we index, each with its own lengths for BM25
+type Field int
+
+const (
+	Title Field = iota
+	Alt
+	Transcript
+	NumFields
+)
+
+var fieldNames = [NumFields]string{"title", "alt", "transcript"}
+
+func (f Field) String() string {
+	return fieldNames[f]
+}
+
+// bump this when tokenizing or the layout changes, so that old
+// indexes get rebuilt rather than misread
+const version = 2
+
+// Posting is where a term appears in one field of one comic
+type Posting struct {
+	Num   int
+	Field Field
+	Pos   []int32
+}
+
+// Doc is what we keep about a comic to rank it and list it without
+// going back to comics.json
+type Doc struct {
+	Num   int
+	Title string
+	Year  string
+	Month string
+	Day   string
+	Len   [NumFields]int
+}
+
+type Index struct {
+	Version int
+
+	// comics.json as it was when we last indexed it
+	Size    int64
+	ModTime time.Time
+
+	Docs  map[int]*Doc
+	Terms map[string][]Posting
+	Total [NumFields]int // the sum of each field's lengths
+
+	// a word for each term, the shortest seen, to suggest in its place
+	Words map[string]string
+}
+
+func New() *Index {
+	return &Index{
+		Version: version,
+		Docs:    make(map[int]*Doc),
+		Terms:   make(map[string][]Posting),
+		Words:   make(map[string]string),
+	}
+}
+
+// Add indexes a comic; adding one we have already does nothing
+func (x *Index) Add(c *xkcd.Comic) {
+	if _, ok := x.Docs[c.Num]; ok {
+		return
+	}
+
+	d := &Doc{Num: c.Num, Title: c.Title, Year: c.Year, Month: c.Month, Day: c.Day}
+
+	for f, text := range [NumFields]string{c.Title, c.Alt, c.Transcript} {
+		tokens := Tokenize(text)
+		d.Len[f] = len(tokens)
+		x.Total[f] += len(tokens)
+
+		byTerm := make(map[string][]int32)
+		var order []string
+
+		for _, t := range tokens {
+			if byTerm[t.Term] == nil {
+				order = append(order, t.Term)
+			}
+			byTerm[t.Term] = append(byTerm[t.Term], int32(t.Pos))
+		}
+
+		for _, term := range order {
+			x.Terms[term] = append(x.Terms[term], Posting{c.Num, Field(f), byTerm[term]})
+		}
+
+		for _, w := range split(text) {
+			if stopWords[w] {
+				continue
+			}
+
+			t := Stem(w)
+			if cur, ok := x.Words[t]; !ok || len(w) < len(cur) || len(w) == len(cur) && w < cur {
+				x.Words[t] = w
+			}
+		}
+	}
+
+	x.Docs[c.Num] = d
+}
+
+// Path is where the index for a comics file is kept, comics.idx for
+// comics.json or comics.ndjson.gz
+func Path(comics string) string {
+	comics = strings.TrimSuffix(comics, ".gz")
+	return strings.TrimSuffix(comics, filepath.Ext(comics)) + ".idx"
+}
+
+// Open loads the index kept next to the comics file, bringing it up to
+// date first. Comics are only ever added, so if the file has grown we
+// index just the new ones; if any have gone we start again.
+func Open(comics string) (*Index, error) {
+	info, err := os.Stat(comics)
+	if err != nil {
+		return nil, err
+	}
+
+	x, err := load(Path(comics))
+	if err != nil {
+		x = New()
+	}
+
+	if x.Size == info.Size() && x.ModTime.Equal(info.ModTime()) {
+		return x, nil
+	}
+
+	// one comic at a time, decoding only those we don't have
+	seen := make(map[int]bool)
+	add := func(num int, data json.RawMessage) error {
+		seen[num] = true
+		if _, ok := x.Docs[num]; ok {
+			return nil
+		}
+
+		var c xkcd.Comic
+		if err := json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("comic %d: %w", num, err)
+		}
+
+		x.Add(&c)
+		return nil
+	}
+
+	if err := xkcd.Scan(comics, add); err != nil {
+		return nil, err
+	}
+
+	for num := range x.Docs {
+		if !seen[num] {
+			x = New()
+			if err := xkcd.Scan(comics, add); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	x.Size, x.ModTime = info.Size(), info.ModTime()
+
+	// a read-only directory just means indexing again next time
+	if err := x.save(Path(comics)); err != nil {
+		fmt.Fprintf(os.Stderr, "can't save the index: %s\n", err)
+	}
+
+	return x, nil
+}
+
+func load(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var x Index
+	if err := gob.NewDecoder(f).Decode(&x); err != nil {
+		return nil, err
+	}
+
+	if x.Version != version {
+		return nil, errors.New("old index")
+	}
+
+	return &x, nil
+}
+
+func (x *Index) save(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".index-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := gob.NewEncoder(tmp).Encode(x); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,624 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A query is made of words and "quoted phrases", all of which must
+// match unless joined by OR; NOT or a leading - excludes, and
+// parentheses group. A word or phrase can be limited to one field with
+// title:, alt: or transcript:, and num: and date: take a value or a
+// range, as in num:1000..1100 or date:2010-05..2011. A word ending in
+// ~ also matches words a letter or two off, as "velocraptor~" does
+// "velociraptor"; ~1 or ~2 says how many edits, ~ picks by length.
+//
+//	query   = or
+//	or      = and { "OR" and }
+//	and     = unary { ["AND"] unary }
+//	unary   = ("NOT" | "-") unary | primary
+//	primary = "(" or ")" | [field ":"] (word ["~" [digit]] | phrase)
+
+// ParseError points at where in the query things went wrong
+type ParseError struct {
+	Pos int // in bytes
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("at %d: %s", e.Pos+1, e.Msg)
+}
+
+// Show draws the query with a caret under the problem
+func (e *ParseError) Show(query string) string {
+	col := utf8.RuneCountInString(query[:min(e.Pos, len(query))])
+	return fmt.Sprintf("%s\n%s^ %s", query, strings.Repeat(" ", col), e.Msg)
+}
+
+// AnyField is a word or phrase that can match in any field
+const AnyField Field = -1
+
+type node interface {
+	// match returns the comics that match, out of all of them
+	match(x *Index) map[int]bool
+}
+
+type termNode struct {
+	field Field
+	term  string
+}
+
+type phraseNode struct {
+	field  Field
+	tokens []Token
+}
+
+type andNode []node
+type orNode []node
+
+type notNode struct {
+	n node
+}
+
+// rangeNode keeps the comics whose number, or date as YYYYMMDD, is
+// between lo and hi
+type rangeNode struct {
+	date   bool
+	lo, hi int
+}
+
+type tokenKind int
+
+const (
+	tEOF tokenKind = iota
+	tWord
+	tPhrase
+	tField
+	tLParen
+	tRParen
+	tAnd
+	tOr
+	tNot
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var fields = map[string]bool{"title": true, "alt": true, "transcript": true, "num": true, "date": true}
+
+func lex(q string) ([]token, error) {
+	var out []token
+
+	for i := 0; i < len(q); {
+		c := q[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			out = append(out, token{tLParen, "(", i})
+			i++
+		case c == ')':
+			out = append(out, token{tRParen, ")", i})
+			i++
+		case c == '-' && (i+1 < len(q) && q[i+1] != ' '):
+			out = append(out, token{tNot, "-", i})
+			i++
+		case c == '"':
+			end := strings.IndexByte(q[i+1:], '"')
+			if end < 0 {
+				return nil, &ParseError{i, "unterminated phrase, missing closing \""}
+			}
+			out = append(out, token{tPhrase, q[i+1 : i+1+end], i})
+			i += end + 2
+		default:
+			start := i
+			for i < len(q) && !strings.ContainsRune(" \t\n()\"", rune(q[i])) {
+				if q[i] == ':' {
+					break
+				}
+				i++
+			}
+
+			word := q[start:i]
+
+			if i < len(q) && q[i] == ':' {
+				switch {
+				case fields[strings.ToLower(word)]:
+					out = append(out, token{tField, strings.ToLower(word), start})
+					i++
+					continue
+				case isName(word):
+					return nil, &ParseError{start, fmt.Sprintf("unknown field %q, expected title, alt, transcript, num or date", word)}
+				}
+
+				// like 10:30, it's all one word
+				for i < len(q) && !strings.ContainsRune(" \t\n()\"", rune(q[i])) {
+					i++
+				}
+				word = q[start:i]
+			}
+
+			switch word {
+			case "AND":
+				out = append(out, token{tAnd, word, start})
+			case "OR":
+				out = append(out, token{tOr, word, start})
+			case "NOT":
+				out = append(out, token{tNot, word, start})
+			default:
+				out = append(out, token{tWord, word, start})
+			}
+		}
+	}
+
+	return append(out, token{tEOF, "", len(q)}), nil
+}
+
+func isName(s string) bool {
+	for _, r := range s {
+		if r < 'a' || r > 'z' {
+			if r < 'A' || r > 'Z' {
+				return false
+			}
+		}
+	}
+	return s != ""
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tEOF {
+		p.i++
+	}
+	return t
+}
+
+// Parse turns a query into something we can match; a nil node means
+// the query had nothing to look for, like only stop words
+func Parse(q string) (node, error) {
+	toks, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tEOF {
+		if t.kind == tRParen {
+			return nil, &ParseError{t.pos, "unexpected ), no ( to close"}
+		}
+		return nil, &ParseError{t.pos, fmt.Sprintf("unexpected %q", t.text)}
+	}
+
+	return n, nil
+}
+
+func (p *parser) or() (node, error) {
+	var kids orNode
+
+	for {
+		n, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			kids = append(kids, n)
+		}
+
+		if p.peek().kind != tOr {
+			break
+		}
+
+		op := p.next()
+		if k := p.peek().kind; k == tEOF || k == tRParen || k == tOr {
+			return nil, &ParseError{op.pos, "OR needs something on both sides"}
+		}
+	}
+
+	switch len(kids) {
+	case 0:
+		return nil, nil
+	case 1:
+		return kids[0], nil
+	}
+	return kids, nil
+}
+
+func (p *parser) and() (node, error) {
+	var kids andNode
+
+	if p.peek().kind == tAnd {
+		return nil, &ParseError{p.peek().pos, "AND needs something on both sides"}
+	}
+
+	for {
+		switch p.peek().kind {
+		case tEOF, tRParen, tOr:
+			switch len(kids) {
+			case 0:
+				if t := p.peek(); t.kind == tOr || t.kind == tRParen && p.i > 0 && p.toks[p.i-1].kind == tLParen {
+					return nil, &ParseError{t.pos, "expected a word or phrase"}
+				}
+				return nil, nil
+			case 1:
+				return kids[0], nil
+			}
+			return kids, nil
+
+		case tAnd:
+			op := p.next()
+			if k := p.peek().kind; k == tEOF || k == tRParen || k == tOr || k == tAnd {
+				return nil, &ParseError{op.pos, "AND needs something on both sides"}
+			}
+		}
+
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			kids = append(kids, n)
+		}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if p.peek().kind == tNot {
+		op := p.next()
+
+		if k := p.peek().kind; k == tEOF || k == tRParen || k == tOr || k == tAnd {
+			return nil, &ParseError{op.pos, "expected something to exclude after " + op.text}
+		}
+
+		n, err := p.unary()
+		if err != nil || n == nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tLParen:
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek().kind != tRParen {
+			return nil, &ParseError{t.pos, "( is never closed"}
+		}
+		p.next()
+		return n, nil
+
+	case tWord, tPhrase:
+		return text(AnyField, t)
+
+	case tField:
+		v := p.next()
+		if v.kind != tWord && v.kind != tPhrase {
+			return nil, &ParseError{v.pos, fmt.Sprintf("expected a value after %s:", t.text)}
+		}
+
+		switch t.text {
+		case "num":
+			return numRange(v)
+		case "date":
+			return dateRange(v)
+		}
+
+		return text(fieldIndex(t.text), v)
+	}
+
+	return nil, &ParseError{t.pos, fmt.Sprintf("unexpected %q", t.text)}
+}
+
+func fieldIndex(name string) Field {
+	for f, n := range fieldNames {
+		if n == name {
+			return Field(f)
+		}
+	}
+	return AnyField
+}
+
+// text makes a term, or a phrase if a word splits into several, as
+// "x-ray" does
+func text(f Field, t token) (node, error) {
+	word, dist, fuzz := t.text, Auto, false
+
+	if i := strings.LastIndexByte(word, '~'); i >= 0 && t.kind == tWord {
+		switch d := word[i+1:]; d {
+		case "":
+		case "0", "1", "2":
+			dist = int(d[0] - '0')
+		default:
+			return nil, &ParseError{t.pos + i, "expected ~, ~0, ~1 or ~2 after a word"}
+		}
+		word, fuzz = word[:i], true
+	}
+
+	tokens := Tokenize(word)
+
+	switch {
+	case len(tokens) == 0:
+		return nil, nil
+	case len(tokens) == 1 && fuzz:
+		return fuzzyNode{f, tokens[0].Term, dist}, nil
+	case len(tokens) == 1:
+		return termNode{f, tokens[0].Term}, nil
+	case fuzz:
+		return nil, &ParseError{t.pos, "only a single word can be fuzzy"}
+	}
+
+	return phraseNode{f, tokens}, nil
+}
+
+func numRange(t token) (node, error) {
+	lo, hi, ok := strings.Cut(t.text, "..")
+	if !ok {
+		hi = lo
+	}
+
+	parse := func(s string, def, off int) (int, error) {
+		if s == "" {
+			return def, nil
+		}
+
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, &ParseError{t.pos + off, fmt.Sprintf("%q isn't a comic number", s)}
+		}
+		return n, nil
+	}
+
+	l, err := parse(lo, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := parse(hi, int(^uint(0)>>1), len(lo)+2)
+	if err != nil {
+		return nil, err
+	}
+
+	if l > h {
+		return nil, &ParseError{t.pos, fmt.Sprintf("empty range, %d is after %d", l, h)}
+	}
+
+	return rangeNode{false, l, h}, nil
+}
+
+func dateRange(t token) (node, error) {
+	lo, hi, ok := strings.Cut(t.text, "..")
+	if !ok {
+		hi = lo
+	}
+
+	l, h := 0, 99991231
+
+	if lo != "" {
+		from, _, err := parseDate(lo, t.pos)
+		if err != nil {
+			return nil, err
+		}
+		l = from
+	}
+
+	if hi != "" {
+		_, to, err := parseDate(hi, t.pos+len(lo)+2)
+		if err != nil {
+			return nil, err
+		}
+		h = to
+	}
+
+	if l > h {
+		return nil, &ParseError{t.pos, "empty range, the start is after the end"}
+	}
+
+	return rangeNode{true, l, h}, nil
+}
+
+// parseDate reads YYYY, YYYY-MM or YYYY-MM-DD and returns the first
+// and last day it covers as YYYYMMDD
+func parseDate(s string, pos int) (int, int, error) {
+	bad := &ParseError{pos, fmt.Sprintf("%q isn't a date, expected YYYY, YYYY-MM or YYYY-MM-DD", s)}
+
+	parts := strings.Split(s, "-")
+	if len(parts) > 3 || len(parts[0]) != 4 {
+		return 0, 0, bad
+	}
+
+	var n [3]int
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 {
+			return 0, 0, bad
+		}
+		n[i] = v
+	}
+
+	if len(parts) > 1 && (n[1] < 1 || n[1] > 12) || len(parts) > 2 && (n[2] < 1 || n[2] > 31) {
+		return 0, 0, bad
+	}
+
+	from, to := n[0]*10000+101, n[0]*10000+1231
+
+	switch len(parts) {
+	case 2:
+		from, to = n[0]*10000+n[1]*100+1, n[0]*10000+n[1]*100+31
+	case 3:
+		from = n[0]*10000 + n[1]*100 + n[2]
+		to = from
+	}
+
+	return from, to, nil
+}
+
+func (n termNode) match(x *Index) map[int]bool {
+	out := make(map[int]bool)
+
+	for _, p := range x.Terms[n.term] {
+		if n.field == AnyField || p.Field == n.field {
+			out[p.Num] = true
+		}
+	}
+
+	return out
+}
+
+func (n phraseNode) match(x *Index) map[int]bool {
+	// where each word is, by comic and field
+	type key struct {
+		num   int
+		field Field
+	}
+
+	var at []map[key]map[int32]bool
+
+	for _, t := range n.tokens {
+		m := make(map[key]map[int32]bool)
+
+		for _, p := range x.Terms[t.Term] {
+			if n.field != AnyField && p.Field != n.field {
+				continue
+			}
+
+			k := key{p.Num, p.Field}
+			if m[k] == nil {
+				m[k] = make(map[int32]bool)
+			}
+			for _, pos := range p.Pos {
+				m[k][pos] = true
+			}
+		}
+
+		at = append(at, m)
+	}
+
+	out := make(map[int]bool)
+
+	// every word must follow the first at the same distance as in
+	// the phrase, stop words included
+	for k, starts := range at[0] {
+	starts:
+		for start := range starts {
+			for i, t := range n.tokens[1:] {
+				want := start + int32(t.Pos-n.tokens[0].Pos)
+				if !at[i+1][k][want] {
+					continue starts
+				}
+			}
+
+			out[k.num] = true
+			break
+		}
+	}
+
+	return out
+}
+
+func (n andNode) match(x *Index) map[int]bool {
+	out := n[0].match(x)
+
+	for _, kid := range n[1:] {
+		m := kid.match(x)
+		for num := range out {
+			if !m[num] {
+				delete(out, num)
+			}
+		}
+	}
+
+	return out
+}
+
+func (n orNode) match(x *Index) map[int]bool {
+	out := make(map[int]bool)
+
+	for _, kid := range n {
+		for num := range kid.match(x) {
+			out[num] = true
+		}
+	}
+
+	return out
+}
+
+func (n notNode) match(x *Index) map[int]bool {
+	m := n.n.match(x)
+	out := make(map[int]bool)
+
+	for num := range x.Docs {
+		if !m[num] {
+			out[num] = true
+		}
+	}
+
+	return out
+}
+
+func (n rangeNode) match(x *Index) map[int]bool {
+	out := make(map[int]bool)
+
+	for num, d := range x.Docs {
+		v := num
+
+		if n.date {
+			y, _ := strconv.Atoi(d.Year)
+			m, _ := strconv.Atoi(d.Month)
+			day, _ := strconv.Atoi(d.Day)
+			v = y*10000 + m*100 + day
+		}
+
+		if v >= n.lo && v <= n.hi {
+			out[num] = true
+		}
+	}
+
+	return out
+}
+
+// scored lists the words that add to a comic's score: all of them but
+// those under a NOT
+func scored(n node, out *[]termNode) {
+	switch n := n.(type) {
+	case termNode:
+		*out = append(*out, n)
+	case phraseNode:
+		for _, t := range n.tokens {
+			*out = append(*out, termNode{n.field, t.Term})
+		}
+	case andNode:
+		for _, kid := range n {
+			scored(kid, out)
+		}
+	case orNode:
+		for _, kid := range n {
+			scored(kid, out)
+		}
+	}
+}
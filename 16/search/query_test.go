@@ -0,0 +1,101 @@
+package search
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"16/xkcd"
+)
+
+func TestQuery(t *testing.T) {
+	x := New()
+	for _, c := range []xkcd.Comic{
+		{Num: 10, Year: "2006", Month: "1", Day: "1", Title: "Bed Bugs", Transcript: "The bed is warm."},
+		{Num: 20, Year: "2008", Month: "6", Day: "15", Title: "Warm Bed", Alt: "his bed is warm"},
+		{Num: 30, Year: "2010", Month: "5", Day: "2", Title: "Compilers", Transcript: "Compiling..."},
+		{Num: 40, Year: "2010", Month: "12", Day: "31", Title: "Sleep", Alt: "bed time", Transcript: "warm milk"},
+	} {
+		x.Add(&c)
+	}
+
+	for _, st := range []struct {
+		query string
+		want  []int
+	}{
+		{`bed`, []int{10, 20, 40}},
+		{`bed warm`, []int{10, 20, 40}},
+		{`"bed is warm"`, []int{10, 20}},
+		{`"warm bed"`, []int{20}},
+		{`title:bed`, []int{10, 20}},
+		{`alt:"bed time"`, []int{40}},
+		{`compiler OR sleep`, []int{30, 40}},
+		{`bed NOT title:warm`, []int{10, 40}},
+		{`bed -alt:bed`, []int{10}},
+		{`(bed OR compile) AND date:2010`, []int{30, 40}},
+		{`num:15..35`, []int{20, 30}},
+		{`num:..20`, []int{10, 20}},
+		{`date:2008-06..2010-05`, []int{20, 30}},
+		{`date:2010-12-31`, []int{40}},
+		{`the`, nil},
+	} {
+		hits, err := x.Search(st.query, DefaultBoosts)
+		if err != nil {
+			t.Errorf("%s: %v", st.query, err)
+			continue
+		}
+
+		var got []int
+		for _, h := range hits {
+			got = append(got, h.Doc.Num)
+		}
+		slices.Sort(got)
+
+		if !slices.Equal(got, st.want) {
+			t.Errorf("%s: expected %v, got %v", st.query, st.want, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, st := range []struct {
+		query string
+		pos   int
+	}{
+		{`"bed is`, 0},
+		{`bed OR`, 4},
+		{`OR bed`, 0},
+		{`bed AND`, 4},
+		{`(bed warm`, 0},
+		{`bed)`, 3},
+		{`()`, 1},
+		{`author:randall`, 0},
+		{`num:ten`, 4},
+		{`num:10..x`, 8},
+		{`num:20..10`, 4},
+		{`date:2010-13`, 5},
+		{`date:2011..2010`, 5},
+		{`bed NOT`, 4},
+		{`title:`, 6},
+		{`bed~3`, 3},
+		{`x-ray~`, 0},
+	} {
+		_, err := Parse(st.query)
+
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("%s: expected a parse error, got %v", st.query, err)
+			continue
+		}
+
+		if pe.Pos != st.pos {
+			t.Errorf("%s: expected an error at %d, got %v", st.query, st.pos, pe.Show(st.query))
+		}
+	}
+
+	// the caret counts runes, not bytes
+	err := &ParseError{Pos: 7, Msg: "here"}
+	if got := err.Show(`"café" )`); got != "\"café\" )\n      ^ here" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,148 @@
+package search
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"16/xkcd"
+)
+
+func TestStem(t *testing.T) {
+	for word, want := range map[string]string{
+		"caresses": "caress", "ponies": "poni", "cats": "cat", "feed": "feed",
+		"agreed": "agre", "plastered": "plaster", "motoring": "motor", "sing": "sing",
+		"hopping": "hop", "filing": "file", "happy": "happi", "relational": "relat",
+		"hopeful": "hope", "goodness": "good", "electrical": "electr",
+		"adjustment": "adjust", "sleeping": "sleep", "beds": "bed", "xkcd": "xkcd",
+	} {
+		if got := Stem(word); got != want {
+			t.Errorf("%s: expected %s, got %s", word, want, got)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Don't sleep in the BEDS!")
+	want := []Token{{"dont", 0}, {"sleep", 1}, {"bed", 4}}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+var comics = []xkcd.Comic{
+	{Num: 1, Title: "Beds", Transcript: "A man lies in bed."},
+	{Num: 2, Title: "Embedded", Transcript: "An embedded system sleeps."},
+	{Num: 3, Title: "Sleep", Alt: "Bed time", Transcript: "She is sleeping in her bed, and the bed is warm."},
+	{Num: 4, Title: "Compiler", Transcript: "Nothing to see here"},
+}
+
+func TestSearch(t *testing.T) {
+	x := New()
+	for i := range comics {
+		x.Add(&comics[i])
+	}
+
+	nums := func(hits []Hit, err error) []int {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out []int
+		for _, h := range hits {
+			out = append(out, h.Doc.Num)
+		}
+		return out
+	}
+
+	// "embedded" doesn't match, and a word in the title counts most
+	if got := nums(x.Search("bed", DefaultBoosts)); !slices.Equal(got, []int{1, 3}) {
+		t.Errorf("bed: got %v", got)
+	}
+
+	if got := nums(x.Search("bed", Boosts{Title: 0, Alt: 1, Transcript: 1})); !slices.Equal(got, []int{3, 1}) {
+		t.Errorf("bed without the title: got %v", got)
+	}
+
+	if got := nums(x.Search("sleep bed", DefaultBoosts)); !slices.Equal(got, []int{3}) {
+		t.Errorf("sleep bed: got %v", got)
+	}
+
+	if got, _ := x.Search("the", DefaultBoosts); got != nil {
+		t.Errorf("stop words only: got %v", got)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comics.json")
+
+	save := func(cs []xkcd.Comic) {
+		raw := make(map[int]json.RawMessage)
+		for _, c := range cs {
+			raw[c.Num], _ = json.Marshal(c)
+		}
+
+		if err := xkcd.WriteFile(path, raw); err != nil {
+			t.Fatal(err)
+		}
+
+		// make sure the change shows even on coarse clocks
+		later := time.Now().Add(time.Duration(len(cs)) * time.Second)
+		os.Chtimes(path, later, later)
+	}
+
+	save(comics[:2])
+
+	x, err := Open(path)
+	if err != nil || len(x.Docs) != 2 {
+		t.Fatalf("expected 2 comics, got %v %v", x, err)
+	}
+
+	save(comics)
+
+	if x, err = Open(path); err != nil || len(x.Docs) != 4 {
+		t.Fatalf("expected 4 comics after growing, got %v", err)
+	}
+
+	if hits, _ := x.Search("compiler", DefaultBoosts); len(hits) != 1 {
+		t.Errorf("new comic not searchable: %v", hits)
+	}
+
+	// the saved index is up to date, so it's used as is
+	if x, err = load(Path(path)); err != nil || len(x.Docs) != 4 {
+		t.Errorf("saved index has %v", err)
+	}
+
+	save(comics[1:])
+
+	if x, _ = Open(path); len(x.Docs) != 3 || x.Docs[1] != nil {
+		t.Errorf("expected a rebuild without comic 1, got %d", len(x.Docs))
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	terms := New().HighlightTerms(`sleeping -title:bed "warm  beds"`, Transcript, false)
+	if want := []string{"sleep", "warm", "bed"}; !slices.Equal(terms, want) {
+		t.Fatalf("expected %v, got %v", want, terms)
+	}
+
+	text := "Long ago,   there was a quiet town where nobody ever slept. She is sleeping in her bed, and the bed is warm."
+	s := MakeSnippet(text, terms, 60)
+
+	if s.Text != "…ever slept. She is sleeping in her bed, and the bed is warm." {
+		t.Fatalf("got %q", s.Text)
+	}
+
+	var marked []string
+	for _, h := range s.Highlights {
+		marked = append(marked, s.Text[h[0]:h[1]])
+	}
+
+	if want := []string{"sleeping", "bed", "bed", "warm"}; !slices.Equal(marked, want) {
+		t.Errorf("expected %v marked, got %v", want, marked)
+	}
+}
@@ -0,0 +1,163 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Snippet is a piece of a field around the words that matched, with
+// the byte ranges of those words in Text
+type Snippet struct {
+	Text       string   `json:"text"`
+	Highlights [][2]int `json:"highlights,omitempty"`
+}
+
+// HighlightTerms returns the stemmed words of a query that could have
+// matched in the field, leaving out those under a NOT; fuzzy words
+// bring the terms near them
+func (x *Index) HighlightTerms(query string, f Field, fuzz bool) []string {
+	n, err := Parse(query)
+	if err != nil || n == nil {
+		return nil
+	}
+
+	if fuzz {
+		n = fuzzy(n)
+	}
+
+	var terms []termNode
+	scored(x.expand(n), &terms)
+
+	var out []string
+	for _, t := range terms {
+		if t.field == AnyField || t.field == f {
+			out = append(out, t.term)
+		}
+	}
+
+	return out
+}
+
+// MakeSnippet cuts about width bytes out of text, starting a little
+// before the first word whose stem is one of terms, and marks every
+// such word in it. With no match it's the start of the text.
+func MakeSnippet(text string, terms []string, width int) Snippet {
+	want := make(map[string]bool)
+	for _, t := range terms {
+		want[t] = true
+	}
+
+	var marks [][2]int
+	for _, w := range words(text) {
+		if want[Stem(normal(text[w[0]:w[1]]))] {
+			marks = append(marks, w)
+		}
+	}
+
+	start := 0
+	if len(marks) > 0 && marks[0][0] > width/4 {
+		start = wordStart(text, marks[0][0]-width/4)
+	}
+
+	end := len(text)
+	if end-start > width {
+		end = wordEnd(text, start+width)
+	}
+
+	var s Snippet
+	prefix := 0
+
+	if start > 0 {
+		s.Text = "…"
+		prefix = len(s.Text)
+	}
+
+	s.Text += strings.Join(strings.Fields(text[start:end]), " ")
+
+	// collapsing the spaces moved things, so find the words again
+	// rather than shift the ranges
+	for _, w := range words(s.Text) {
+		if want[Stem(normal(s.Text[w[0]:w[1]]))] && w[0] >= prefix {
+			s.Highlights = append(s.Highlights, w)
+		}
+	}
+
+	if end < len(text) {
+		s.Text += "…"
+	}
+
+	return s
+}
+
+// words returns the byte ranges of the words in text, split the way
+// Tokenize splits them
+func words(text string) [][2]int {
+	var out [][2]int
+	start := -1
+
+	for i, r := range text {
+		in := unicode.IsLetter(r) || unicode.IsDigit(r) ||
+			start >= 0 && (r == '\'' || r == '’' || unicode.Is(unicode.Mn, r))
+
+		switch {
+		case in && start < 0:
+			start = i
+		case !in && start >= 0:
+			out = append(out, [2]int{start, trimQuote(text, start, i)})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		out = append(out, [2]int{start, trimQuote(text, start, len(text))})
+	}
+
+	return out
+}
+
+// trimQuote drops a closing quote from the end of a word
+func trimQuote(text string, start, end int) int {
+	for end > start {
+		r, size := utf8.DecodeLastRuneInString(text[:end])
+		if r != '\'' && r != '’' {
+			break
+		}
+		end -= size
+	}
+	return end
+}
+
+// wordStart moves i back to the start of the word it's in
+func wordStart(text string, i int) int {
+	for i > 0 && !utf8.RuneStart(text[i]) {
+		i--
+	}
+
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:i])
+		if unicode.IsSpace(r) {
+			break
+		}
+		i -= size
+	}
+
+	return i
+}
+
+// wordEnd moves i forward to the end of the word it's in
+func wordEnd(text string, i int) int {
+	for i < len(text) && !utf8.RuneStart(text[i]) {
+		i++
+	}
+
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+
+	return i
+}
@@ -0,0 +1,226 @@
+package search
+
+import "strings"
+
+// Stem reduces an English word to its stem with Porter's algorithm,
+// e.g. "sleeping" and "sleeps" to "sleep". Words with anything but
+// the letters a-z, and very short ones, are left alone.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+
+	s := &stemmer{[]byte(word)}
+	s.step1a()
+	s.step1b()
+	s.step1c()
+	s.replace(step2, 0)
+	s.replace(step3, 0)
+	s.step4()
+	s.step5()
+
+	return string(s.b)
+}
+
+type stemmer struct {
+	b []byte
+}
+
+// cons reports whether b[i] is a consonant; y is one unless it
+// follows a consonant
+func (s *stemmer) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.cons(i-1)
+	}
+	return true
+}
+
+// measure counts the vowel-consonant sequences in b[:n]
+func (s *stemmer) measure(n int) int {
+	m, i := 0, 0
+
+	for i < n && s.cons(i) {
+		i++
+	}
+
+	for i < n {
+		for i < n && !s.cons(i) {
+			i++
+		}
+		if i == n {
+			break
+		}
+		for i < n && s.cons(i) {
+			i++
+		}
+		m++
+	}
+
+	return m
+}
+
+func (s *stemmer) hasVowel(n int) bool {
+	for i := range n {
+		if !s.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleCons reports whether b[:n] ends in a double consonant
+func (s *stemmer) doubleCons(n int) bool {
+	return n >= 2 && s.b[n-1] == s.b[n-2] && s.cons(n-1)
+}
+
+// cvc reports whether b[:n] ends consonant-vowel-consonant, the last
+// not being w, x or y, as in "hop" but not "snow"
+func (s *stemmer) cvc(n int) bool {
+	if n < 3 || !s.cons(n-1) || s.cons(n-2) || !s.cons(n-3) {
+		return false
+	}
+
+	c := s.b[n-1]
+	return c != 'w' && c != 'x' && c != 'y'
+}
+
+func (s *stemmer) ends(suffix string) bool {
+	return strings.HasSuffix(string(s.b), suffix)
+}
+
+// set replaces the last n letters with r
+func (s *stemmer) set(n int, r string) {
+	s.b = append(s.b[:len(s.b)-n], r...)
+}
+
+func (s *stemmer) step1a() {
+	switch {
+	case s.ends("sses"), s.ends("ies"):
+		s.set(2, "")
+	case s.ends("ss"):
+	case s.ends("s"):
+		s.set(1, "")
+	}
+}
+
+func (s *stemmer) step1b() {
+	if s.ends("eed") {
+		if s.measure(len(s.b)-3) > 0 {
+			s.set(1, "")
+		}
+		return
+	}
+
+	var n int
+	switch {
+	case s.ends("ed"):
+		n = 2
+	case s.ends("ing"):
+		n = 3
+	default:
+		return
+	}
+
+	stem := len(s.b) - n
+	if !s.hasVowel(stem) {
+		return
+	}
+	s.set(n, "")
+
+	switch {
+	case s.ends("at"), s.ends("bl"), s.ends("iz"):
+		s.set(0, "e")
+	case s.doubleCons(stem):
+		if c := s.b[stem-1]; c != 'l' && c != 's' && c != 'z' {
+			s.set(1, "")
+		}
+	case s.measure(stem) == 1 && s.cvc(stem):
+		s.set(0, "e")
+	}
+}
+
+func (s *stemmer) step1c() {
+	if s.ends("y") && s.hasVowel(len(s.b)-1) {
+		s.b[len(s.b)-1] = 'i'
+	}
+}
+
+var step2 = [][2]string{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"abli", "able"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"},
+	{"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"},
+	{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"},
+	{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+}
+
+var step3 = [][2]string{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+// replace swaps the first matching suffix if what's left before it
+// has a measure above min; a suffix that matches but fails the test
+// stops the step all the same
+func (s *stemmer) replace(rules [][2]string, min int) {
+	for _, r := range rules {
+		if s.ends(r[0]) {
+			if s.measure(len(s.b)-len(r[0])) > min {
+				s.set(len(r[0]), r[1])
+			}
+			return
+		}
+	}
+}
+
+var step4 = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment", "ent",
+	"ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+func (s *stemmer) step4() {
+	// the longest suffix wins, so "ement" before "ment" before "ent"
+	best := ""
+	for _, suf := range step4 {
+		if len(suf) > len(best) && s.ends(suf) {
+			best = suf
+		}
+	}
+
+	if best == "" {
+		return
+	}
+
+	stem := len(s.b) - len(best)
+
+	if best == "ion" && (stem == 0 || s.b[stem-1] != 's' && s.b[stem-1] != 't') {
+		return
+	}
+
+	if s.measure(stem) > 1 {
+		s.set(len(best), "")
+	}
+}
+
+func (s *stemmer) step5() {
+	n := len(s.b)
+
+	if s.b[n-1] == 'e' {
+		if m := s.measure(n - 1); m > 1 || m == 1 && !s.cvc(n-1) {
+			s.set(1, "")
+		}
+	}
+
+	n = len(s.b)
+	if s.b[n-1] == 'l' && s.doubleCons(n) && s.measure(n) > 1 {
+		s.set(1, "")
+	}
+}
@@ -0,0 +1,70 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Token is a word as indexed, with its place in the text; stop words
+// are dropped but still take up a place, so phrases line up
+type Token struct {
+	Term string
+	Pos  int
+}
+
+// Tokenize splits text into folded, stemmed terms, so that "bed"
+// matches "beds" but not "embedded", and "Café" matches "cafe"
+func Tokenize(text string) []Token {
+	words := split(text)
+	tokens := make([]Token, 0, len(words))
+
+	for i, w := range words {
+		if stopWords[w] {
+			continue
+		}
+		tokens = append(tokens, Token{Stem(w), i})
+	}
+
+	return tokens
+}
+
+// "don't" is one word, not "don" and "t"
+var apostrophes = strings.NewReplacer("'", "", "’", "")
+
+// split returns the folded words of text, stop words and all
+func split(text string) []string {
+	return strings.FieldsFunc(Fold(apostrophes.Replace(text)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// normal is a word as split would leave it
+func normal(word string) string {
+	return Fold(apostrophes.Replace(word))
+}
+
+// Terms is Tokenize without the positions
+func Terms(text string) []string {
+	var terms []string
+	for _, t := range Tokenize(text) {
+		terms = append(terms, t.Term)
+	}
+	return terms
+}
+
+var stopWords = func() map[string]bool {
+	m := make(map[string]bool)
+
+	for _, w := range strings.Fields(`a about above after again against all am an and any are as at
+		be because been before being below between both but by can could did do does doing down
+		during each few for from further had has have having he her here hers herself him himself
+		his how i if in into is it its itself just me more most my myself no nor not now of off on
+		once only or other our ours ourselves out over own same she should so some such than that
+		the their theirs them themselves then there these they this those through to too under
+		until up very was we were what when where which while who whom why will with would you
+		your yours yourself yourselves`) {
+		m[w] = true
+	}
+
+	return m
+}()
@@ -0,0 +1,143 @@
+// Package xkcd downloads comic metadata from xkcd.com and keeps it in
+// a local file.
+package xkcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const DefaultBaseURL = "https://xkcd.com"
+
+// ErrMissing means there's no comic with that number, like #404
+var ErrMissing = errors.New("no such comic")
+
+// KnownGaps are the numbers that were never published
+var KnownGaps = map[int]bool{404: true}
+
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+	Retries int           // extra attempts after a transient failure
+	Backoff time.Duration // the first wait, doubled after each attempt
+}
+
+func NewClient() *Client {
+	return &Client{
+		BaseURL: DefaultBaseURL,
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+		Retries: 4,
+		Backoff: 500 * time.Millisecond,
+	}
+}
+
+// Latest returns the number of the newest comic
+func (c *Client) Latest(ctx context.Context) (int, error) {
+	body, err := c.get(ctx, "/info.0.json")
+	if err != nil {
+		return 0, err
+	}
+
+	var info struct {
+		Num int `json:"num"`
+	}
+
+	if err := json.Unmarshal(body, &info); err != nil {
+		return 0, fmt.Errorf("latest comic: %w", err)
+	}
+
+	return info.Num, nil
+}
+
+// Get returns the metadata for one comic by number, as it was sent
+func (c *Client) Get(ctx context.Context, num int) (json.RawMessage, error) {
+	return c.get(ctx, fmt.Sprintf("/%d/info.0.json", num))
+}
+
+// transient is a failure worth trying again
+type transient struct {
+	err   error
+	after time.Duration // from Retry-After, if the server said
+}
+
+func (t *transient) Error() string { return t.err.Error() }
+func (t *transient) Unwrap() error { return t.err }
+
+func (c *Client) get(ctx context.Context, path string) ([]byte, error) {
+	return c.retry(ctx, c.BaseURL+path, true)
+}
+
+// retry fetches a URL, trying again after transient failures; a
+// JSON response that doesn't parse counts as one
+func (c *Client) retry(ctx context.Context, url string, isJSON bool) ([]byte, error) {
+	wait := c.Backoff
+
+	for attempt := 0; ; attempt++ {
+		body, err := c.fetch(ctx, url, isJSON)
+
+		var t *transient
+		if err == nil || !errors.As(err, &t) || attempt >= c.Retries {
+			return body, err
+		}
+
+		// full jitter, so that workers that failed together don't
+		// all come back together
+		d := time.Duration(rand.Int64N(int64(wait) + 1))
+		if t.after > 0 {
+			d = t.after
+		}
+
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		wait *= 2
+	}
+}
+
+func (c *Client) fetch(ctx context.Context, url string, isJSON bool) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &transient{err: err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrMissing
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return nil, &transient{fmt.Errorf("%s: %s", url, resp.Status), time.Duration(secs) * time.Second}
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &transient{err: err}
+	}
+
+	// a cut-off response is worth another go
+	if isJSON && !json.Valid(body) {
+		return nil, &transient{err: fmt.Errorf("%s: invalid JSON", url)}
+	}
+
+	return body, nil
+}
@@ -0,0 +1,46 @@
+package xkcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Comic is the metadata xkcd publishes for each comic, as it comes
+type Comic struct {
+	Month      string `json:"month"`
+	Num        int    `json:"num"`
+	Link       string `json:"link"`
+	Year       string `json:"year"`
+	News       string `json:"news"`
+	SafeTitle  string `json:"safe_title"`
+	Transcript string `json:"transcript"`
+	Alt        string `json:"alt"`
+	Img        string `json:"img"`
+	Title      string `json:"title"`
+	Day        string `json:"day"`
+
+	// where the loader mirrored the image, if it did
+	Local *Image `json:"local_img,omitempty"`
+}
+
+// URL is the comic's page on xkcd.com
+func (c *Comic) URL() string {
+	return fmt.Sprintf("https://xkcd.com/%d/", c.Num)
+}
+
+// Decode parses the comics read by ReadFile, in number order
+func Decode(raw map[int]json.RawMessage) ([]Comic, error) {
+	comics := make([]Comic, 0, len(raw))
+
+	for num, data := range raw {
+		var c Comic
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("comic %d: %w", num, err)
+		}
+		comics = append(comics, c)
+	}
+
+	slices.SortFunc(comics, func(a, b Comic) int { return a.Num - b.Num })
+	return comics, nil
+}
@@ -0,0 +1,71 @@
+package xkcd
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+type Result struct {
+	Num  int
+	Data json.RawMessage
+	Err  error // ErrMissing for a gap
+}
+
+// Missing lists the comics up to latest that we don't have yet,
+// leaving out the known gaps; have can be the comics or just their
+// numbers
+func Missing[V any](have map[int]V, latest int) []int {
+	var nums []int
+
+	for n := 1; n <= latest; n++ {
+		if _, ok := have[n]; !ok && !KnownGaps[n] {
+			nums = append(nums, n)
+		}
+	}
+
+	return nums
+}
+
+// Fetch gets the comics with no more than workers requests at a time;
+// the results come back in any order, and the channel is closed once
+// they're all in or ctx is done
+func (c *Client) Fetch(ctx context.Context, nums []int, workers int) <-chan Result {
+	// with no workers nothing would ever be fetched
+	workers = max(workers, 1)
+	todo := make(chan int)
+	results := make(chan Result)
+
+	go func() {
+		defer close(todo)
+
+		for _, n := range nums {
+			select {
+			case todo <- n:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for n := range todo {
+				data, err := c.Get(ctx, n)
+				results <- Result{n, data, err}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
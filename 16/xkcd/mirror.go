@@ -0,0 +1,369 @@
+package xkcd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"iter"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	// the formats xkcd publishes in, for the dimensions
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Image is a comic's image as kept in the mirror, recorded with the
+// comic under "local_img"
+type Image struct {
+	Path   string `json:"path"` // slash-separated, relative to the comics file
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Mirror keeps images by the hash of their contents, so a picture
+// used by more than one comic is only stored once
+type Mirror struct {
+	Dir    string // where the images go
+	Base   string // what the recorded paths are relative to
+	Verify bool   // hash every image we have, not just check its size
+}
+
+type ImageResult struct {
+	Num    int
+	Image  *Image // to record with the comic, nil if what we had was fine
+	Broken error  // what was wrong with the copy we had, if anything
+	Err    error  // ErrMissing if the image isn't there
+}
+
+// Image downloads an image, retrying like Get does
+func (c *Client) Image(ctx context.Context, url string) ([]byte, error) {
+	return c.retry(ctx, url, false)
+}
+
+// Sync checks the image of each comic against the mirror, downloading
+// the ones we don't have or whose copy doesn't check out. Comics that
+// share a mirrored file or an image URL are checked and fetched once,
+// together. There's a result for every comic with an image, in any
+// order; the channel is closed once they're all done or ctx is. The
+// comics are read before Sync returns, keeping only their images, so
+// they can come straight from a file and the caller is free to record
+// the results wherever the comics came from.
+func (m *Mirror) Sync(ctx context.Context, c *Client, comics iter.Seq2[int, json.RawMessage], workers int) <-chan ImageResult {
+	// with no workers the groups would never be taken and Sync would hang
+	workers = max(workers, 1)
+	groups, bad := group(comics)
+	todo := make(chan []entry)
+	results := make(chan ImageResult)
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(todo)
+
+		for _, r := range bad {
+			select {
+			case results <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		for _, g := range groups {
+			select {
+			case todo <- g:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for g := range todo {
+				for _, r := range m.sync(ctx, c, g) {
+					results <- r
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// entry is a comic with an image, as Sync needs it
+type entry struct {
+	num   int
+	img   string
+	local *Image
+}
+
+// group sorts the comics with images by the file they're mirrored in,
+// or else by their image URL, with results for the ones that won't
+// decode
+func group(comics iter.Seq2[int, json.RawMessage]) ([][]entry, []ImageResult) {
+	var groups [][]entry
+	var bad []ImageResult
+	at := make(map[string]int)
+
+	for n, raw := range comics {
+		var comic struct {
+			Img   string `json:"img"`
+			Local *Image `json:"local_img"`
+		}
+
+		if err := json.Unmarshal(raw, &comic); err != nil {
+			bad = append(bad, ImageResult{Num: n, Err: err})
+			continue
+		}
+
+		if comic.Img == "" {
+			continue
+		}
+
+		key := "img " + comic.Img
+		if comic.Local != nil {
+			key = "local " + comic.Local.Path
+		}
+
+		e := entry{n, comic.Img, comic.Local}
+		if i, ok := at[key]; ok {
+			groups[i] = append(groups[i], e)
+			continue
+		}
+
+		at[key] = len(groups)
+		groups = append(groups, []entry{e})
+	}
+
+	return groups, bad
+}
+
+// sync checks and fetches the image a group of comics share, with a
+// result for each of them
+func (m *Mirror) sync(ctx context.Context, c *Client, group []entry) []ImageResult {
+	first := group[0]
+	out := make([]ImageResult, len(group))
+
+	var broken error
+	if first.local != nil {
+		if broken = m.Check(first.local); broken == nil {
+			for i, e := range group {
+				out[i] = ImageResult{Num: e.num}
+			}
+			return out
+		}
+	}
+
+	data, err := c.Image(ctx, first.img)
+
+	var img *Image
+	if err == nil {
+		img, err = m.Save(data, first.img)
+	}
+
+	for i, e := range group {
+		out[i] = ImageResult{Num: e.num, Image: img, Broken: broken, Err: err}
+	}
+
+	return out
+}
+
+// Check reports what's wrong with a mirrored image, if anything
+func (m *Mirror) Check(img *Image) error {
+	file := m.local(img.Path)
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	if info.Size() != img.Size {
+		return fmt.Errorf("%s: expected %d bytes, found %d", img.Path, img.Size, info.Size())
+	}
+
+	if !m.Verify {
+		return nil
+	}
+
+	sum, err := hashFile(file)
+	if err != nil {
+		return err
+	}
+
+	if sum != img.SHA256 {
+		return fmt.Errorf("%s: checksum doesn't match", img.Path)
+	}
+
+	return nil
+}
+
+// Save stores an image under its hash, unless a good copy is there
+// already, and describes it; the name it came by gives the extension
+func (m *Mirror) Save(data []byte, name string) (*Image, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	img := &Image{Size: int64(len(data)), SHA256: hash}
+
+	// not being able to read the size is no reason not to keep it
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err == nil {
+		img.Width, img.Height = cfg.Width, cfg.Height
+	}
+
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" && format != "" {
+		ext = "." + format
+	}
+
+	file := filepath.Join(m.Dir, hash[:2], hash+ext)
+
+	rel, err := filepath.Rel(m.Base, file)
+	if err != nil {
+		rel = file
+	}
+	img.Path = filepath.ToSlash(rel)
+
+	if m.Check(img) == nil {
+		return img, nil
+	}
+
+	return img, writeFile(file, data)
+}
+
+// local is where a recorded path is on disk
+func (m *Mirror) local(p string) string {
+	p = filepath.FromSlash(p)
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(m.Base, p)
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeFile puts the whole file there or none of it, as WriteFile does
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".image-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// SetImage records a mirrored image with a comic under "local_img"
+func SetImage(raw json.RawMessage, img *Image) (json.RawMessage, error) {
+	return setField(raw, "local_img", img)
+}
+
+// setField sets one field of a JSON object, leaving the others as they
+// were and in the same order
+func setField(raw json.RawMessage, key string, value any) (json.RawMessage, error) {
+	v, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, errors.New("comic isn't a JSON object")
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	found := false
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		k := t.(string)
+
+		var field json.RawMessage
+		if err := dec.Decode(&field); err != nil {
+			return nil, err
+		}
+
+		if k == key {
+			field, found = v, true
+		}
+
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(k)
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(field)
+	}
+
+	if !found {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
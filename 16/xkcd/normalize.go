@@ -0,0 +1,138 @@
+package xkcd
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Line is one line of a transcript: what a speaker says, a [[scene
+// description]], or if neither, some text in the panel
+type Line struct {
+	Speaker string `json:"speaker,omitempty"`
+	Scene   bool   `json:"scene,omitempty"`
+	Text    string `json:"text"`
+}
+
+// Normal is a comic tidied up: a real date, a plain title and the
+// transcript split into lines, with the alt text it carried taken out
+type Normal struct {
+	Num       int       `json:"num"`
+	Title     string    `json:"title"`
+	SafeTitle string    `json:"safe_title"`
+	Date      time.Time `json:"date"`
+	Img       string    `json:"img,omitempty"`
+	Alt       string    `json:"alt,omitempty"`
+	Lines     []Line    `json:"transcript,omitempty"`
+}
+
+// Date is when the comic was published, at midnight UTC
+func (c *Comic) Date() (time.Time, error) {
+	y, err1 := strconv.Atoi(c.Year)
+	m, err2 := strconv.Atoi(c.Month)
+	d, err3 := strconv.Atoi(c.Day)
+
+	if err1 != nil || err2 != nil || err3 != nil {
+		return time.Time{}, fmt.Errorf("bad date %q-%q-%q", c.Year, c.Month, c.Day)
+	}
+
+	// time.Date would take 2010-02-30 as March 2nd
+	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	if t.Year() != y || int(t.Month()) != m || t.Day() != d {
+		return time.Time{}, fmt.Errorf("no such date %d-%02d-%02d", y, m, d)
+	}
+
+	return t, nil
+}
+
+var tags = regexp.MustCompile(`<[^>]*>`)
+
+// PlainTitle is the title without the HTML some of them have, as in
+// "Clich&eacute;d Exchanges"
+func (c *Comic) PlainTitle() string {
+	return html.UnescapeString(tags.ReplaceAllString(c.Title, ""))
+}
+
+// Normalize tidies the comic; it fails only if the date makes no sense
+func (c *Comic) Normalize() (*Normal, error) {
+	date, err := c.Date()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Normal{
+		Num:       c.Num,
+		Title:     c.PlainTitle(),
+		SafeTitle: c.SafeTitle,
+		Date:      date,
+		Img:       c.Img,
+		Alt:       c.Alt,
+		Lines:     ParseTranscript(c.Transcript),
+	}, nil
+}
+
+var (
+	// {{Alt: ...}}, {{Title text: ...}} and the like, or just {{...}}
+	curly   = regexp.MustCompile(`(?s)\{\{(.*?)\}\}`)
+	altText = regexp.MustCompile(`(?is)\{\{\s*(?:alt|title)(?:[ -]?(?:text|title))?\s*:\s*(.*?)\}\}`)
+
+	scene = regexp.MustCompile(`(?s)\[\[(.*?)\]\]`)
+
+	// a name of up to five words before a colon; a number first, as in
+	// 10:30, isn't a name
+	speaker = regexp.MustCompile(`^(\pL[^:\[\]{}]*):\s*(.*)$`)
+)
+
+// ParseTranscript splits a transcript into lines of speech, scene
+// descriptions and other text, leaving out the alt text that most of
+// them end with
+func ParseTranscript(t string) []Line {
+	t = curly.ReplaceAllString(t, "")
+
+	var out []Line
+
+	for _, raw := range strings.Split(t, "\n") {
+		// a scene in the middle of a line comes before it
+		for _, m := range scene.FindAllStringSubmatch(raw, -1) {
+			if s := clean(m[1]); s != "" {
+				out = append(out, Line{Scene: true, Text: s})
+			}
+		}
+
+		text := clean(scene.ReplaceAllString(raw, ""))
+		if text == "" {
+			continue
+		}
+
+		if m := speaker.FindStringSubmatch(text); m != nil && len(strings.Fields(m[1])) <= 5 {
+			if said := clean(m[2]); said != "" {
+				out = append(out, Line{Speaker: clean(m[1]), Text: said})
+				continue
+			}
+		}
+
+		out = append(out, Line{Text: text})
+	}
+
+	return out
+}
+
+// TranscriptAlt is the alt text a transcript carries as {{Alt: ...}}
+// or {{Title text: ...}}, if it does
+func TranscriptAlt(t string) string {
+	m := altText.FindAllStringSubmatch(t, -1)
+	if m == nil {
+		return ""
+	}
+
+	return clean(m[len(m)-1][1])
+}
+
+// clean collapses runs of spaces and trims them
+func clean(s string) string {
+	return strings.Join(strings.FieldsFunc(s, unicode.IsSpace), " ")
+}
@@ -0,0 +1,296 @@
+package xkcd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Format is how comics are laid out in a file: a JSON array, as xkcd
+// itself might send them, or one comic per line (NDJSON), either of
+// them optionally gzipped
+type Format struct {
+	Lines bool
+	Gzip  bool
+}
+
+// FormatOf picks the format for a file from its name: .ndjson or
+// .jsonl for lines, and .gz on the end to compress
+func FormatOf(path string) Format {
+	var f Format
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".gz" {
+		f.Gzip = true
+		ext = strings.ToLower(filepath.Ext(strings.TrimSuffix(path, filepath.Ext(path))))
+	}
+
+	f.Lines = ext == ".ndjson" || ext == ".jsonl"
+	return f
+}
+
+// Reader reads comics one at a time, so that however many there are
+// only one is in memory at once. It works out the format itself.
+type Reader struct {
+	dec   *json.Decoder
+	gz    *gzip.Reader
+	array bool
+	done  bool
+}
+
+// NewReader tells gzip apart by its magic bytes, and an array from
+// lines by the first thing in it
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	rd := &Reader{}
+
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		rd.gz = gz
+		br = bufio.NewReader(gz)
+	}
+
+	// skip to the first thing that isn't a space
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			rd.done = true
+			return rd, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			br.UnreadByte()
+			rd.array = c == '['
+			break
+		}
+	}
+
+	rd.dec = json.NewDecoder(br)
+
+	if rd.array {
+		// the [
+		if _, err := rd.dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	return rd, nil
+}
+
+// Next returns the next comic and its number as it was saved, or
+// io.EOF after the last
+func (r *Reader) Next() (int, json.RawMessage, error) {
+	if r.done || r.array && !r.dec.More() {
+		r.done = true
+		return 0, nil, io.EOF
+	}
+
+	var item json.RawMessage
+	if err := r.dec.Decode(&item); err != nil {
+		return 0, nil, err
+	}
+
+	var c struct {
+		Num int `json:"num"`
+	}
+
+	if err := json.Unmarshal(item, &c); err != nil {
+		return 0, nil, err
+	}
+
+	return c.Num, item, nil
+}
+
+func (r *Reader) Close() error {
+	if r.gz != nil {
+		return r.gz.Close()
+	}
+	return nil
+}
+
+// Scan calls fn with each comic in a file in turn; a file that
+// doesn't exist yet is empty
+func Scan(path string, fn func(num int, data json.RawMessage) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer r.Close()
+
+	for {
+		num, data, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if err := fn(num, data); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadFile loads the comics saved in a file, keeping each one as it
+// was sent; a file that doesn't exist yet is empty
+func ReadFile(path string) (map[int]json.RawMessage, error) {
+	have := make(map[int]json.RawMessage)
+
+	err := Scan(path, func(num int, data json.RawMessage) error {
+		have[num] = data
+		return nil
+	})
+
+	return have, err
+}
+
+// Writer writes comics one at a time in a format; Close finishes the
+// file, but leaves w open
+type Writer struct {
+	bw  *bufio.Writer
+	gz  *gzip.Writer
+	f   Format
+	n   int
+	buf bytes.Buffer
+}
+
+func NewWriter(w io.Writer, f Format) *Writer {
+	wr := &Writer{f: f}
+
+	if f.Gzip {
+		wr.gz = gzip.NewWriter(w)
+		w = wr.gz
+	}
+
+	wr.bw = bufio.NewWriter(w)
+	return wr
+}
+
+func (w *Writer) Write(data json.RawMessage) error {
+	if !w.f.Lines {
+		sep := ",\n"
+		if w.n == 0 {
+			sep = "[\n"
+		}
+		w.bw.WriteString(sep)
+		w.n++
+
+		_, err := w.bw.Write(data)
+		return err
+	}
+
+	// a comic split over lines would be read as several
+	w.buf.Reset()
+	if err := json.Compact(&w.buf, data); err != nil {
+		return err
+	}
+	w.buf.WriteByte('\n')
+	w.n++
+
+	_, err := w.bw.Write(w.buf.Bytes())
+	return err
+}
+
+func (w *Writer) Close() error {
+	if !w.f.Lines {
+		if w.n == 0 {
+			w.bw.WriteString("[")
+		}
+		w.bw.WriteString("\n]\n")
+	}
+
+	if err := w.bw.Flush(); err != nil {
+		return err
+	}
+
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+// Write outputs the comics in number order, as a JSON array with one
+// comic per line
+func Write(w io.Writer, comics map[int]json.RawMessage) error {
+	return write(w, Format{}, comics)
+}
+
+func write(w io.Writer, f Format, comics map[int]json.RawMessage) error {
+	nums := make([]int, 0, len(comics))
+	for n := range comics {
+		nums = append(nums, n)
+	}
+	slices.Sort(nums)
+
+	cw := NewWriter(w, f)
+
+	for _, n := range nums {
+		if err := cw.Write(comics[n]); err != nil {
+			return err
+		}
+	}
+
+	return cw.Close()
+}
+
+// WriteFile replaces the file in one go, so an interrupted run never
+// leaves half a file behind; its name says what format to use
+func WriteFile(path string, comics map[int]json.RawMessage) error {
+	return Replace(path, func(w io.Writer) error {
+		return write(w, FormatOf(path), comics)
+	})
+}
+
+// Replace is WriteFile for comics written one at a time with fn, which
+// is free to read the file it replaces as it goes, e.g. through a
+// Writer in the format of its name; if fn fails the file is left as
+// it was
+func Replace(path string, fn func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".comics-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp makes it private
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := fn(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,210 @@
+package xkcd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// the kinds of problem Validate finds
+const (
+	BadRecord     = "bad-record"     // not a comic we can decode
+	Duplicate     = "duplicate"      // the same number twice
+	Gap           = "gap"            // a number missing, other than the known gaps
+	MissingField  = "missing-field"  // no title, image or alt text
+	BadDate       = "bad-date"       // a date that doesn't parse, or doesn't exist
+	DateOrder     = "date-order"     // published before the comic before it
+	TitleMarkup   = "title-markup"   // HTML or entities in the title
+	TitleMismatch = "title-mismatch" // title and safe_title disagree
+	BadMarkup     = "bad-markup"     // [[ or {{ in a transcript that isn't closed
+	AltMismatch   = "alt-mismatch"   // the alt text in the transcript isn't the comic's
+)
+
+// Problem is something wrong with one comic
+type Problem struct {
+	Num    int    `json:"num"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+type Report struct {
+	Comics   int            `json:"comics"`
+	Counts   map[string]int `json:"counts"`
+	Problems []Problem      `json:"problems"`
+}
+
+func (r *Report) add(num int, kind, format string, args ...any) {
+	r.Problems = append(r.Problems, Problem{num, kind, fmt.Sprintf(format, args...)})
+	r.Counts[kind]++
+}
+
+// Validate checks every comic in a file, reading them one at a time
+func Validate(path string) (*Report, error) {
+	r := &Report{Counts: make(map[string]int)}
+	dates := make(map[int]time.Time)
+	seen := make(map[int]bool)
+
+	err := Scan(path, func(num int, data json.RawMessage) error {
+		r.Comics++
+
+		if seen[num] {
+			r.add(num, Duplicate, "comic %d appears more than once", num)
+			return nil
+		}
+		seen[num] = true
+
+		var c Comic
+		if err := json.Unmarshal(data, &c); err != nil {
+			r.add(num, BadRecord, "%s", err)
+			return nil
+		}
+
+		if d, err := c.Date(); err != nil {
+			r.add(num, BadDate, "%s", err)
+		} else {
+			dates[num] = d
+		}
+
+		r.check(&c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	nums := make([]int, 0, len(seen))
+	for n := range seen {
+		nums = append(nums, n)
+	}
+	slices.Sort(nums)
+
+	for i := 1; i < len(nums); i++ {
+		for n := nums[i-1] + 1; n < nums[i]; n++ {
+			if !KnownGaps[n] {
+				r.add(n, Gap, "no comic %d", n)
+			}
+		}
+
+		prev, cur := dates[nums[i-1]], dates[nums[i]]
+		if !prev.IsZero() && !cur.IsZero() && cur.Before(prev) {
+			r.add(nums[i], DateOrder, "published %s, before %d on %s",
+				cur.Format(time.DateOnly), nums[i-1], prev.Format(time.DateOnly))
+		}
+	}
+
+	slices.SortStableFunc(r.Problems, func(a, b Problem) int {
+		return cmp.Compare(a.Num, b.Num)
+	})
+
+	return r, nil
+}
+
+// check looks for what's wrong with a comic on its own
+func (r *Report) check(c *Comic) {
+	for _, f := range [][2]string{{"title", c.Title}, {"img", c.Img}, {"alt", c.Alt}} {
+		if strings.TrimSpace(f[1]) == "" {
+			r.add(c.Num, MissingField, "no %s", f[0])
+		}
+	}
+
+	plain := c.PlainTitle()
+	if plain != c.Title {
+		r.add(c.Num, TitleMarkup, "title %q is %q without the markup", c.Title, plain)
+	}
+
+	if plain != c.SafeTitle {
+		r.add(c.Num, TitleMismatch, "title %q, safe_title %q", plain, c.SafeTitle)
+	}
+
+	t := c.Transcript
+	for _, pair := range [][2]string{{"[[", "]]"}, {"{{", "}}"}} {
+		if open, shut := strings.Count(t, pair[0]), strings.Count(t, pair[1]); open != shut {
+			r.add(c.Num, BadMarkup, "%d %s but %d %s in the transcript", open, pair[0], shut, pair[1])
+		}
+	}
+
+	// some transcripts were attached to the wrong comic, which the
+	// alt text they end with gives away
+	if alt := TranscriptAlt(t); alt != "" && c.Alt != "" && similarity(alt, c.Alt) < 0.5 {
+		r.add(c.Num, AltMismatch, "transcript has alt text %q", shorten(alt, 60))
+	}
+}
+
+// similarity is the share of words two texts have in common, from 0
+// for none to 1 for all, ignoring case and punctuation. Texts with no
+// words at all, like an alt text of ":(", are the same or they aren't.
+func similarity(a, b string) float64 {
+	wa, wb := wordSet(a), wordSet(b)
+	if len(wa) == 0 && len(wb) == 0 && strings.TrimSpace(a) == strings.TrimSpace(b) {
+		return 1
+	}
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+
+	both := 0
+	for w := range wa {
+		if wb[w] {
+			both++
+		}
+	}
+
+	return float64(both) / float64(max(len(wa), len(wb)))
+}
+
+func wordSet(s string) map[string]bool {
+	set := make(map[string]bool)
+
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		set[w] = true
+	}
+
+	return set
+}
+
+func shorten(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
+
+// Write prints the report as text, a summary then a line for each
+// problem, or as JSON
+func (r *Report) Write(w io.Writer, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	kinds := make([]string, 0, len(r.Counts))
+	for k := range r.Counts {
+		kinds = append(kinds, k)
+	}
+	slices.Sort(kinds)
+
+	fmt.Fprintf(w, "%d comics, %d problems\n", r.Comics, len(r.Problems))
+	for _, k := range kinds {
+		fmt.Fprintf(w, "%6d %s\n", r.Counts[k], k)
+	}
+
+	if len(r.Problems) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	for _, p := range r.Problems {
+		if _, err := fmt.Fprintf(w, "%5d %s: %s\n", p.Num, p.Kind, p.Detail); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
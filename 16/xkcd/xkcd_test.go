@@ -0,0 +1,374 @@
+package xkcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	var mu sync.Mutex
+	tries := map[int]int{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/info.0.json" {
+			fmt.Fprint(w, `{"num": 6}`)
+			return
+		}
+
+		var n int
+		fmt.Sscanf(r.URL.Path, "/%d/info.0.json", &n)
+
+		mu.Lock()
+		tries[n]++
+		try := tries[n]
+		mu.Unlock()
+
+		switch {
+		case n == 5:
+			http.NotFound(w, r)
+		case n == 3 && try < 3:
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		default:
+			fmt.Fprintf(w, `{"num": %d, "title": "comic %d"}`, n, n)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient()
+	c.BaseURL = srv.URL
+	c.Backoff = time.Millisecond
+
+	latest, err := c.Latest(context.Background())
+	if err != nil || latest != 6 {
+		t.Fatalf("latest: %d %v", latest, err)
+	}
+
+	have := map[int]json.RawMessage{1: json.RawMessage(`{"num": 1}`)}
+	todo := Missing(have, latest)
+
+	if !slices.Equal(todo, []int{2, 3, 4, 5, 6}) {
+		t.Fatalf("missing: %v", todo)
+	}
+
+	var got, gaps []int
+	for r := range c.Fetch(context.Background(), todo, 3) {
+		switch {
+		case errors.Is(r.Err, ErrMissing):
+			gaps = append(gaps, r.Num)
+		case r.Err != nil:
+			t.Errorf("%d: %v", r.Num, r.Err)
+		default:
+			got = append(got, r.Num)
+			have[r.Num] = r.Data
+		}
+	}
+
+	slices.Sort(got)
+	if !slices.Equal(got, []int{2, 3, 4, 6}) || !slices.Equal(gaps, []int{5}) {
+		t.Errorf("got %v, gaps %v", got, gaps)
+	}
+
+	if tries[1] != 0 || tries[3] != 3 {
+		t.Errorf("tries: %v", tries)
+	}
+
+	// no workers still means one
+	n := 0
+	for range c.Fetch(context.Background(), []int{2, 4}, 0) {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("got %d results with 0 workers", n)
+	}
+
+	// retries run out
+	c.Retries = 1
+	tries[3] = 0
+	if _, err := c.Get(context.Background(), 3); err == nil {
+		t.Errorf("expected an error after 2 tries")
+	}
+
+	path := filepath.Join(t.TempDir(), "comics.json")
+	if err := WriteFile(path, have); err != nil {
+		t.Fatal(err)
+	}
+
+	back, err := ReadFile(path)
+	if err != nil || len(back) != 5 || string(back[1]) != `{"num": 1}` {
+		t.Errorf("read back %d comics: %v", len(back), err)
+	}
+}
+
+func TestKnownGaps(t *testing.T) {
+	have := map[int]json.RawMessage{}
+	for n := 1; n <= 410; n++ {
+		if n != 404 && n != 407 {
+			have[n] = nil
+		}
+	}
+
+	if todo := Missing(have, 410); !slices.Equal(todo, []int{407}) {
+		t.Errorf("expected only 407, got %v", todo)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	var pic bytes.Buffer
+	png.Encode(&pic, image.NewGray(image.Rect(0, 0, 3, 2)))
+
+	var mu sync.Mutex
+	downloads := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone.png" {
+			http.NotFound(w, r)
+			return
+		}
+
+		mu.Lock()
+		downloads++
+		mu.Unlock()
+		w.Write(pic.Bytes())
+	}))
+	defer srv.Close()
+
+	c := NewClient()
+	c.Backoff = time.Millisecond
+
+	// 1 and 2 share a picture, 3's is gone and 4 has none
+	comics := map[int]json.RawMessage{
+		1: json.RawMessage(fmt.Sprintf(`{"num": 1, "img": "%s/a.png", "title": "one"}`, srv.URL)),
+		2: json.RawMessage(fmt.Sprintf(`{"num": 2, "img": "%s/b.png"}`, srv.URL)),
+		3: json.RawMessage(fmt.Sprintf(`{"num": 3, "img": "%s/gone.png"}`, srv.URL)),
+		4: json.RawMessage(`{"num": 4}`),
+	}
+
+	base := t.TempDir()
+	m := &Mirror{Dir: filepath.Join(base, "images"), Base: base}
+
+	sync := func() (changed int) {
+		for r := range m.Sync(context.Background(), c, maps.All(comics), 2) {
+			switch {
+			case r.Num == 3 && errors.Is(r.Err, ErrMissing):
+			case r.Err != nil:
+				t.Fatalf("%d: %v", r.Num, r.Err)
+			case r.Image != nil:
+				data, err := SetImage(comics[r.Num], r.Image)
+				if err != nil {
+					t.Fatalf("%d: %v", r.Num, err)
+				}
+				comics[r.Num] = data
+				changed++
+			}
+		}
+		return changed
+	}
+
+	if n := sync(); n != 2 {
+		t.Fatalf("expected 2 images recorded, got %d", n)
+	}
+
+	all, err := Decode(comics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := all[0].Local
+	if img == nil || all[1].Local == nil || all[2].Local != nil || all[3].Local != nil {
+		t.Fatalf("unexpected images recorded: %s %s", comics[1], comics[3])
+	}
+
+	if *all[1].Local != *img || img.Width != 3 || img.Height != 2 || !strings.HasPrefix(img.Path, "images/") {
+		t.Errorf("unexpected image %+v", img)
+	}
+
+	// the other fields stay as they were
+	if !strings.HasPrefix(string(comics[1]), `{"num":1,"img":`) || all[0].Title != "one" {
+		t.Errorf("comic rewritten as %s", comics[1])
+	}
+
+	// a second run has nothing to do
+	if n := sync(); n != 0 || downloads != 2 {
+		t.Errorf("expected nothing fetched, got %d and %d downloads", n, downloads)
+	}
+
+	// same size but different contents is only found with Verify
+	file := filepath.Join(base, filepath.FromSlash(img.Path))
+	os.WriteFile(file, bytes.Repeat([]byte{0}, int(img.Size)), 0o644)
+
+	if n := sync(); n != 0 {
+		t.Errorf("expected the size check to pass, got %d fetched", n)
+	}
+
+	// the two comics share the file, which is fetched once for both
+	m.Verify = true
+	if n := sync(); n != 2 || downloads != 3 {
+		t.Errorf("expected the image repaired for both, got %d and %d downloads", n, downloads)
+	}
+
+	if err := m.Check(img); err != nil {
+		t.Errorf("still broken: %v", err)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	comics := map[int]json.RawMessage{
+		2: json.RawMessage(`{"num": 2, "title": "two"}`),
+		1: json.RawMessage("{\n  \"num\": 1,\n  \"title\": \"one\"\n}"),
+	}
+
+	dir := t.TempDir()
+
+	for name, want := range map[string]Format{
+		"comics.json":        {},
+		"comics.ndjson":      {Lines: true},
+		"comics.JSONL":       {Lines: true},
+		"comics.json.gz":     {Gzip: true},
+		"comics.ndjson.gz":   {Lines: true, Gzip: true},
+		"comics":             {},
+		"comics.backup.json": {},
+	} {
+		if f := FormatOf(name); f != want {
+			t.Errorf("%s: expected %+v, got %+v", name, want, f)
+		}
+
+		path := filepath.Join(dir, name)
+		if err := WriteFile(path, comics); err != nil {
+			t.Fatal(err)
+		}
+
+		back, err := ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		var buf bytes.Buffer
+		json.Compact(&buf, back[1])
+		if len(back) != 2 || buf.String() != `{"num":1,"title":"one"}` {
+			t.Errorf("%s: read back %q", name, back)
+		}
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "comics.ndjson"))
+	if string(data) != "{\"num\":1,\"title\":\"one\"}\n{\"num\":2,\"title\":\"two\"}\n" {
+		t.Errorf("unexpected lines %q", data)
+	}
+
+	// the contents decide, not the name
+	os.Rename(filepath.Join(dir, "comics.ndjson.gz"), filepath.Join(dir, "misnamed.json"))
+	if back, err := ReadFile(filepath.Join(dir, "misnamed.json")); err != nil || len(back) != 2 {
+		t.Errorf("misnamed: read back %d comics: %v", len(back), err)
+	}
+
+	for _, empty := range []string{"", "  \n", "[]", "[\n]\n"} {
+		path := filepath.Join(dir, "empty.json")
+		os.WriteFile(path, []byte(empty), 0o644)
+
+		if back, err := ReadFile(path); err != nil || len(back) != 0 {
+			t.Errorf("%q: read back %d comics: %v", empty, len(back), err)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`[{"num": 1}, {"num": `), 0o644)
+	if _, err := ReadFile(filepath.Join(dir, "bad.json")); err == nil {
+		t.Errorf("expected a cut-off file to fail")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	c := Comic{
+		Num: 1, Year: "2008", Month: "2", Day: "29",
+		Title:     "Clich&eacute;d",
+		SafeTitle: "Clichd",
+		Alt:       "Don't we all.",
+		Transcript: "[[A boy sits in a barrel.]]\nBoy: I wonder where I'll float next?\n" +
+			"Man [[off-panel]]:  Hello  there\n10:30 PM\n<<Bang>>\n{{Alt: Don't we all.}}",
+	}
+
+	n, err := c.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n.Title != "Clichéd" || !n.Date.Equal(time.Date(2008, 2, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected %+v", n)
+	}
+
+	want := []Line{
+		{Scene: true, Text: "A boy sits in a barrel."},
+		{Speaker: "Boy", Text: "I wonder where I'll float next?"},
+		{Scene: true, Text: "off-panel"},
+		{Speaker: "Man", Text: "Hello there"},
+		{Text: "10:30 PM"},
+		{Text: "<<Bang>>"},
+	}
+
+	if !slices.Equal(n.Lines, want) {
+		t.Errorf("expected %+v, got %+v", want, n.Lines)
+	}
+
+	if alt := TranscriptAlt(c.Transcript); alt != "Don't we all." {
+		t.Errorf("transcript alt %q", alt)
+	}
+
+	for _, d := range [][3]string{{"2009", "2", "29"}, {"2009", "13", "1"}, {"", "1", "1"}} {
+		c := Comic{Year: d[0], Month: d[1], Day: d[2]}
+		if _, err := c.Date(); err == nil {
+			t.Errorf("%v: expected a bad date", d)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comics.ndjson")
+	os.WriteFile(path, []byte(`{"num": 1, "title": "One", "safe_title": "One", "img": "a.png", "alt": "a", "year": "2006", "month": "1", "day": "2"}
+{"num": 2, "title": "T&amp;T", "safe_title": "TT", "img": "b.png", "alt": "b", "year": "2006", "month": "1", "day": "1"}
+{"num": 2, "title": "Again"}
+{"num": 5, "title": "Five", "safe_title": "Five", "img": "", "alt": "the real alt text", "year": "2006", "month": "2", "day": "30", "transcript": "[[scene\n{{Alt: something else entirely}}"}
+{"num": 6, "title": 6}
+{"num": 7, "title": "Sad", "safe_title": "Sad", "img": "g.png", "alt": ":(", "year": "2006", "month": "3", "day": "1", "transcript": "{{Alt: :(}}"}
+`), 0o644)
+
+	r, err := Validate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, p := range r.Problems {
+		got = append(got, fmt.Sprintf("%d %s", p.Num, p.Kind))
+	}
+
+	want := []string{
+		"2 title-markup", "2 title-mismatch", "2 duplicate", "2 date-order",
+		"3 gap", "4 gap",
+		"5 bad-date", "5 missing-field", "5 bad-markup", "5 alt-mismatch",
+		"6 bad-record",
+	}
+
+	// 7's alt text has no words, but it's the same in its transcript
+	if r.Comics != 6 || !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %d comics and %v", want, r.Comics, got)
+	}
+
+	var buf bytes.Buffer
+	r.Write(&buf, "text")
+	if !strings.HasPrefix(buf.String(), "6 comics, 11 problems\n     1 alt-mismatch\n") {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,180 @@
+// Package xkcdtest is a stand-in for xkcd.com, serving comics from a
+// fixture so the loader can be tried offline, and made slow, flaky or
+// strict about rates on purpose.
+package xkcdtest
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Server answers /info.0.json and /N/info.0.json the way xkcd.com
+// does. Set the fields before serving.
+type Server struct {
+	Latency   time.Duration // how long every response takes
+	Jitter    time.Duration // plus up to this much more, at random
+	ErrorRate float64       // share of requests that fail with a 500
+	CutRate   float64       // share of responses cut off half way
+	Missing   map[int]bool  // comics to 404 as though never published
+
+	// requests a second allowed, with bursts of up to Burst, beyond
+	// which they get a 429; 0 for no limit
+	Rate  float64
+	Burst int
+
+	mux      *http.ServeMux
+	mu       sync.Mutex
+	comics   map[int]json.RawMessage
+	latest   int
+	rng      *rand.Rand
+	tokens   float64
+	last     time.Time
+	requests map[string]int
+}
+
+// New serves the comics given, the highest number being the latest
+func New(comics map[int]json.RawMessage) *Server {
+	s := &Server{
+		comics:   comics,
+		rng:      rand.New(rand.NewPCG(1, 1)),
+		requests: make(map[string]int),
+	}
+
+	for n := range comics {
+		s.latest = max(s.latest, n)
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /info.0.json", s.info)
+	s.mux.HandleFunc("GET /{num}/info.0.json", s.comic)
+
+	return s
+}
+
+// Seed makes the random failures and delays repeat from run to run
+func (s *Server) Seed(seed uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rng = rand.New(rand.NewPCG(seed, seed))
+}
+
+// Requests is how many times a path was asked for, "" for all of them
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if path != "" {
+		return s.requests[path]
+	}
+
+	total := 0
+	for _, n := range s.requests {
+		total += n
+	}
+	return total
+}
+
+// what to do with one request, decided up front under the lock
+type plan struct {
+	delay   time.Duration
+	limited time.Duration // wait this long before trying again
+	fail    bool
+	cut     bool
+}
+
+func (s *Server) plan(path string) plan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests[path]++
+
+	var p plan
+	p.delay = s.Latency
+	if s.Jitter > 0 {
+		p.delay += time.Duration(s.rng.Int64N(int64(s.Jitter)))
+	}
+
+	if s.Rate > 0 {
+		now := time.Now()
+		if s.last.IsZero() {
+			s.tokens = float64(max(s.Burst, 1))
+		} else {
+			s.tokens = min(float64(max(s.Burst, 1)), s.tokens+now.Sub(s.last).Seconds()*s.Rate)
+		}
+		s.last = now
+
+		if s.tokens < 1 {
+			p.limited = time.Duration((1 - s.tokens) / s.Rate * float64(time.Second))
+			return p
+		}
+		s.tokens--
+	}
+
+	p.fail = s.rng.Float64() < s.ErrorRate
+	p.cut = !p.fail && s.rng.Float64() < s.CutRate
+	return p
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := s.plan(r.URL.Path)
+
+	select {
+	case <-time.After(p.delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	switch {
+	case p.limited > 0:
+		// whole seconds, as the header wants
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(p.limited.Seconds()))))
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	case p.fail:
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+	case p.cut:
+		s.mux.ServeHTTP(&cutter{ResponseWriter: w}, r)
+	default:
+		s.mux.ServeHTTP(w, r)
+	}
+}
+
+func (s *Server) info(w http.ResponseWriter, r *http.Request) {
+	s.send(w, r, s.latest)
+}
+
+func (s *Server) comic(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.PathValue("num"))
+	if err != nil || s.Missing[n] {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.send(w, r, n)
+}
+
+func (s *Server) send(w http.ResponseWriter, r *http.Request, n int) {
+	body, ok := s.comics[n]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// cutter sends only the first half of a body, like a connection
+// dropped part way through
+type cutter struct {
+	http.ResponseWriter
+}
+
+func (c *cutter) Write(b []byte) (int, error) {
+	c.ResponseWriter.Write(b[:len(b)/2])
+	return len(b), nil
+}
@@ -0,0 +1,105 @@
+package xkcdtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func comics(n int) map[int]json.RawMessage {
+	out := make(map[int]json.RawMessage)
+	for i := 1; i <= n; i++ {
+		out[i] = json.RawMessage(fmt.Sprintf(`{"num": %d, "title": "comic %d"}`, i, i))
+	}
+	return out
+}
+
+func get(t *testing.T, url string) (*http.Response, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestServer(t *testing.T) {
+	s := New(comics(5))
+	s.Missing = map[int]bool{3: true}
+
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	for path, want := range map[string]int{
+		"/info.0.json":     http.StatusOK,
+		"/2/info.0.json":   http.StatusOK,
+		"/3/info.0.json":   http.StatusNotFound,
+		"/6/info.0.json":   http.StatusNotFound,
+		"/two/info.0.json": http.StatusNotFound,
+		"/2/":              http.StatusNotFound,
+	} {
+		if resp, _ := get(t, srv.URL+path); resp.StatusCode != want {
+			t.Errorf("%s: expected %d, got %d", path, want, resp.StatusCode)
+		}
+	}
+
+	if _, body := get(t, srv.URL+"/info.0.json"); body != `{"num": 5, "title": "comic 5"}` {
+		t.Errorf("latest: %s", body)
+	}
+
+	if n := s.Requests("/info.0.json"); n != 2 {
+		t.Errorf("expected 2 requests for the latest, got %d", n)
+	}
+
+	if n := s.Requests(""); n != 7 {
+		t.Errorf("expected 7 requests in all, got %d", n)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	s := New(comics(5))
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	s.ErrorRate = 1
+	if resp, _ := get(t, srv.URL+"/1/info.0.json"); resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected a 500, got %d", resp.StatusCode)
+	}
+
+	s.ErrorRate, s.CutRate = 0, 1
+	if _, body := get(t, srv.URL+"/1/info.0.json"); json.Valid([]byte(body)) {
+		t.Errorf("expected a cut-off body, got %s", body)
+	}
+
+	s.CutRate, s.Latency = 0, 20*time.Millisecond
+	start := time.Now()
+	get(t, srv.URL+"/1/info.0.json")
+	if d := time.Since(start); d < s.Latency {
+		t.Errorf("answered in %s", d)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := New(comics(5))
+	s.Rate, s.Burst = 1, 2
+
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		resp, _ := get(t, srv.URL+"/1/info.0.json")
+		if resp.StatusCode != want {
+			t.Fatalf("request %d: expected %d, got %d", i+1, want, resp.StatusCode)
+		}
+
+		if want == http.StatusTooManyRequests && resp.Header.Get("Retry-After") != "1" {
+			t.Errorf("expected Retry-After: 1, got %q", resp.Header.Get("Retry-After"))
+		}
+	}
+}
@@ -2,45 +2,78 @@ package main
 
 import "fmt"
 
-func generate(limit int, ch chan<- int) {
+// every stage stops when done is closed as well as when its input runs
+// out, so a reader can walk away part way through
+
+func generate(done <-chan struct{}, limit int, ch chan<- int) {
+	defer close(ch)
+
 	for n := range limit {
 		if n < 2 {
 			continue
 		}
-		ch <- n
-	}
 
-	close(ch)
+		select {
+		case ch <- n:
+		case <-done:
+			return
+		}
+	}
 }
 
-func filter(src <-chan int, dst chan<- int, prime int) {
+func filter(done <-chan struct{}, src <-chan int, dst chan<- int, prime int) {
+	defer close(dst)
+
 	for num := range src {
-		if num%prime != 0 {
-			dst <- num
+		if num%prime == 0 {
+			continue
 		}
-	}
 
-	close(dst)
+		select {
+		case dst <- num:
+		case <-done:
+			return
+		}
+	}
 }
 
-func sieve(limit int) {
-	ch := make(chan int)
-	go generate(limit, ch)
+// sieve sends the primes below limit, adding a filter for each one
+func sieve(done <-chan struct{}, limit int) <-chan int {
+	primes := make(chan int)
 
-	for {
-		prime, ok := <-ch
+	go func() {
+		defer close(primes)
 
-		if !ok {
-			break
+		ch := make(chan int)
+		go generate(done, limit, ch)
+
+		for {
+			prime, ok := <-ch
+
+			if !ok {
+				break
+			}
+
+			select {
+			case primes <- prime:
+			case <-done:
+				return
+			}
+
+			ch2 := make(chan int)
+			go filter(done, ch, ch2, prime)
+			ch = ch2
 		}
+	}()
 
-		ch2 := make(chan int)
-		go filter(ch, ch2, prime)
-		ch = ch2
-		fmt.Print(prime, " ")
-	}
+	return primes
 }
 
 func main() {
-	sieve(100)
+	done := make(chan struct{})
+	defer close(done)
+
+	for prime := range sieve(done, 100) {
+		fmt.Print(prime, " ")
+	}
 }
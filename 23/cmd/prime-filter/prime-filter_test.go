@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"leaktest"
+)
+
+func TestSieve(t *testing.T) {
+	leaktest.Check(t)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	got := slices.Collect(func(yield func(int) bool) {
+		for p := range sieve(done, 50) {
+			if !yield(p) {
+				return
+			}
+		}
+	})
+
+	want := []int{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestSieveStop(t *testing.T) {
+	leaktest.Check(t)
+
+	// taking the first few leaves the generator and filters waiting to
+	// send the rest, until done lets them go
+	done := make(chan struct{})
+	primes := sieve(done, 1000)
+
+	for _, want := range []int{2, 3, 5} {
+		if p := <-primes; p != want {
+			t.Errorf("expected %d, got %d", want, p)
+		}
+	}
+
+	close(done)
+}
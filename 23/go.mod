@@ -1,3 +1,13 @@
 module 23
 
-go 1.24
\ No newline at end of file
+go 1.24
+
+require (
+	25 v0.0.0
+	leaktest v0.0.0
+)
+
+replace (
+	25 => ../25
+	leaktest => ../leaktest
+)
@@ -1,48 +1,14 @@
 package main
 
 import (
-	"fmt"
-	"io"
+	"context"
 	"log"
-	"net/http"
-	"os"
 	"time"
-)
-
-type result struct {
-	url     string
-	err     error
-	latency time.Duration
-}
-
-func get(url string, ch chan<- result) {
-	start := time.Now()
-	resp, err := http.Get(url)
-
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get from %s, %s", url, err)
-		ch <- result{
-			url, err, 0,
-		}
-		return
-	}
-
-	defer resp.Body.Close()
-	_, err = io.ReadAll(resp.Body)
-	t := time.Since(start).Round(time.Millisecond)
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Invalid body %s", err)
-		os.Exit(-1)
-	}
-
-	ch <- result{
-		url, nil, t,
-	}
-}
+	"25/prober"
+)
 
 func main() {
-	results := make(chan result)
 	list := []string{
 		"https://www.amazon.com",
 		"https://www.google.com",
@@ -50,17 +16,19 @@ func main() {
 		"https://www.wsj.com",
 	}
 
-	for _, url := range list {
-		go get(url, results)
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// gets them all at once and waits for every one of them, so none is
+	// left running; errors come back like any other result
+	var p prober.Prober
 
-	for range list {
-		r := <-results
-		if r.err != nil {
-			log.Printf("%-20s %s\n", r.url, r.err)
+	for _, r := range p.All(ctx, list) {
+		if r.Err != nil {
+			log.Printf("%-20s %s\n", r.URL, r.Err)
 			continue
 		}
 
-		log.Printf("%-20s %s\n", r.url, r.latency)
+		log.Printf("%-20s %s\n", r.URL, r.Latency.Round(time.Millisecond))
 	}
 }
@@ -1,39 +1,17 @@
 package main
 
 import (
-	"io"
+	"context"
 	"log"
-	"net/http"
 	"time"
-)
-
-type result struct {
-	url     string
-	err     error
-	latency time.Duration
-}
-
-func get(url string, ch chan<- result) {
-	start := time.Now()
-	resp, err := http.Get(url)
-	if err != nil {
-		ch <- result{
-			url, err, 0,
-		}
-		return
-	}
-	defer resp.Body.Close()
-	_, err = io.ReadAll(resp.Body)
-	end := time.Since(start).Round(time.Millisecond)
 
-	ch <- result{
-		url, err, end,
-	}
-}
+	"25/prober"
+)
 
 func main() {
-	stopper := time.After(time.Second * 3)
-	results := make(chan result)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
 	sites := []string{
 		"https://www.amazon.com",
 		"https://www.google.com",
@@ -42,21 +20,19 @@ func main() {
 		"http://localhost:8080/",
 	}
 
-	for i := range sites {
-		go get(sites[i], results)
-	}
+	// gets them all at once; the ones still out when ctx is done are
+	// given up on and come back with its error
+	var p prober.Prober
 
-	for range sites {
-		select {
-		case r := <-results:
-			if r.err != nil {
-				log.Printf("%-20s %s\n", r.url, r.err)
-				continue
-			}
-			log.Printf("%-20s %s\n", r.url, r.latency)
-		case <-stopper:
-			log.Fatalf("Timeout after 3 seconds")
+	for _, r := range p.All(ctx, sites) {
+		if r.Err != nil {
+			log.Printf("%-20s %s\n", r.URL, r.Err)
+			continue
 		}
+		log.Printf("%-20s %s\n", r.URL, r.Latency.Round(time.Millisecond))
+	}
 
+	if ctx.Err() != nil {
+		log.Fatalf("Timeout after 3 seconds")
 	}
 }
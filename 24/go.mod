@@ -1 +1,10 @@
 module 24
+
+go 1.24
+
+require 25 v0.0.0
+
+replace (
+	25 => ../25
+	leaktest => ../leaktest
+)
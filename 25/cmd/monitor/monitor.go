@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"25/monitor"
+)
+
+func main() {
+	interval := flag.Duration("interval", 30*time.Second, "how often to check the endpoints")
+	timeout := flag.Duration("timeout", 5*time.Second, "how long one check may take")
+	confirm := flag.Int("confirm", 3, "checks in a row that must agree before an endpoint is taken to be down or up")
+	webhook := flag.String("webhook", "", "post alerts to this URL as well as logging them")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: monitor [flags] checks.json")
+		os.Exit(-1)
+	}
+
+	checks, err := monitor.Load(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	m := &monitor.Monitor{Checks: checks, Interval: *interval, Confirm: *confirm}
+	m.Prober.Timeout = *timeout
+
+	// a slow webhook holds up the alerts, not the checks
+	alerts := make(chan monitor.Alert, 100)
+	var wg sync.WaitGroup
+
+	m.Alert = func(a monitor.Alert) {
+		if a.State == monitor.Down {
+			log.Printf("%s is down since %s: %s", a.URL, a.Since.Format(time.TimeOnly), a.Reason)
+		} else {
+			log.Printf("%s is up again since %s", a.URL, a.Since.Format(time.TimeOnly))
+		}
+
+		if *webhook == "" {
+			return
+		}
+
+		select {
+		case alerts <- a:
+		default:
+			log.Printf("dropping the alert for %s, the webhook is behind", a.URL)
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		hook := &monitor.Webhook{URL: *webhook}
+		for a := range alerts {
+			// the ones still queued are sent after Ctrl-C, too
+			ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+			if err := hook.Post(ctx, a); err != nil {
+				log.Printf("alert for %s not sent: %s", a.URL, err)
+			}
+			cancel()
+		}
+	}()
+
+	log.Printf("checking %d endpoints every %s", len(checks), *interval)
+	err = m.Run(ctx)
+
+	close(alerts)
+	wg.Wait()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -2,40 +2,25 @@ package main
 
 import (
 	"context"
-	"io"
+	"encoding/json"
+	"flag"
 	"log"
-	"net/http"
+	"os"
 	"time"
-)
 
-type result struct {
-	url     string
-	err     error
-	latency time.Duration
-}
+	"25/prober"
+)
 
-func get(ctx context.Context, url string, ch chan<- result) {
-	start := time.Now()
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+func main() {
+	asJSON := flag.Bool("json", false, "print the results and their timings as JSON")
+	timeout := flag.Duration("timeout", 3*time.Second, "how long to wait for all of them")
+	width := flag.Int("width", 40, "width of the waterfall")
+	flag.Parse()
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		ch <- result{
-			url, err, 0,
-		}
-		return
+	if *width < 1 {
+		log.Fatal("-width has to be at least 1")
 	}
-	defer resp.Body.Close()
-	_, err = io.ReadAll(resp.Body)
-	end := time.Since(start).Round(time.Millisecond)
 
-	ch <- result{
-		url, err, end,
-	}
-}
-
-func main() {
-	results := make(chan result)
 	sites := []string{
 		"https://www.amazon.com",
 		"https://www.google.com",
@@ -44,19 +29,24 @@ func main() {
 		"http://localhost:8080/",
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	if flag.NArg() > 0 {
+		sites = flag.Args()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
 	defer cancel()
 
-	for i := range sites {
-		go get(ctx, sites[i], results)
-	}
+	var p prober.Prober
+	results := p.All(ctx, sites)
 
-	for range sites {
-		r := <-results
-		if r.err != nil {
-			log.Printf("%-20s %s\n", r.url, r.err)
-			continue
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			log.Fatal(err)
 		}
-		log.Printf("%-20s %s\n", r.url, r.latency)
+		return
 	}
+
+	waterfall(os.Stdout, results, *width)
 }
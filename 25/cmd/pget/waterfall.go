@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"25/prober"
+)
+
+// waterfall prints a line for each request with how long each step
+// took, and a bar showing when, all bars on the same scale
+func waterfall(w io.Writer, results []prober.Result, width int) {
+	urlWidth := len("URL")
+	var longest time.Duration
+
+	for _, r := range results {
+		urlWidth = max(urlWidth, len(r.URL))
+		longest = max(longest, r.Latency)
+	}
+
+	fmt.Fprintf(w, "%-*s  %6s %8s %8s %8s %8s %8s %8s\n",
+		urlWidth, "URL", "STATUS", "DNS", "CONNECT", "TLS", "WAIT", "TRANSFER", "TOTAL")
+
+	for _, r := range results {
+		t := r.Timing
+
+		status := "-"
+		if r.Status != 0 {
+			status = fmt.Sprint(r.Status)
+		}
+
+		fmt.Fprintf(w, "%-*s  %6s %8s %8s %8s %8s %8s %8s  ",
+			urlWidth, r.URL, status, ms(t.DNS.Duration()), ms(t.Connect.Duration()), ms(t.TLS.Duration()),
+			ms(t.Wait.Duration()), ms(t.Transfer.Duration()), ms(r.Latency))
+
+		if r.Err != nil {
+			fmt.Fprintln(w, r.Err)
+			continue
+		}
+
+		fmt.Fprintf(w, "|%s|\n", bar(t, longest, width))
+	}
+
+	fmt.Fprintf(w, "\n%*s  d dns  c connect  s tls  w wait  r transfer\n", urlWidth, "")
+}
+
+// bar draws the steps of a request to scale; a step too short to see
+// still gets a mark
+func bar(t prober.Timing, longest time.Duration, width int) string {
+	if width < 1 {
+		return ""
+	}
+
+	b := []byte(strings.Repeat(" ", width))
+	if longest <= 0 {
+		return string(b)
+	}
+
+	// the column a time falls in, width for the very end
+	col := func(d time.Duration) int {
+		return min(int(int64(d)*int64(width)/int64(longest)), width)
+	}
+
+	for _, step := range []struct {
+		span prober.Span
+		mark byte
+	}{
+		{t.DNS, 'd'}, {t.Connect, 'c'}, {t.TLS, 's'}, {t.Wait, 'w'}, {t.Transfer, 'r'},
+	} {
+		if step.span.End == 0 {
+			continue
+		}
+
+		from := min(col(step.span.Start), width-1)
+		to := max(col(step.span.End), from+1)
+		for i := from; i < to; i++ {
+			b[i] = step.mark
+		}
+	}
+
+	return string(b)
+}
+
+// ms rounds to a millisecond, blank for a step that didn't happen
+func ms(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	if d < time.Millisecond {
+		return "<1ms"
+	}
+	return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"25/prober"
+)
+
+// span is from and to in milliseconds
+func span(from, to time.Duration) prober.Span {
+	return prober.Span{Start: from * time.Millisecond, End: to * time.Millisecond}
+}
+
+func TestBar(t *testing.T) {
+	ms := time.Millisecond
+
+	for _, st := range []struct {
+		name    string
+		t       prober.Timing
+		longest time.Duration
+		width   int
+		want    string
+	}{
+		{
+			"every step",
+			prober.Timing{DNS: span(0, 10), Connect: span(10, 30), TLS: span(30, 50), Wait: span(50, 80), Transfer: span(80, 100)},
+			100 * ms, 10, "dccsswwwrr",
+		},
+		{
+			"reused connection",
+			prober.Timing{Wait: span(0, 50), Transfer: span(50, 100), Reused: true},
+			100 * ms, 10, "wwwwwrrrrr",
+		},
+		{
+			"a shorter request on the same scale",
+			prober.Timing{Wait: span(0, 20), Transfer: span(20, 50), Reused: true},
+			100 * ms, 10, "wwrrr     ",
+		},
+		{
+			"zero-length step",
+			prober.Timing{Connect: span(0, 10), Wait: span(10, 100), Transfer: span(100, 100)},
+			100 * ms, 10, "cwwwwwwwwr",
+		},
+		{
+			"tiny step",
+			prober.Timing{Connect: prober.Span{End: time.Microsecond}, Wait: span(50, 100)},
+			100 * ms, 10, "c    wwwww",
+		},
+		{
+			"longest is one step",
+			prober.Timing{Wait: span(0, 100)},
+			100 * ms, 10, "wwwwwwwwww",
+		},
+		{"one column", prober.Timing{Wait: span(0, 5), Transfer: span(5, 10)}, 10 * ms, 1, "r"},
+		{"nothing yet", prober.Timing{}, 0, 4, "    "},
+		{"no width", prober.Timing{Wait: span(0, 5)}, 5 * ms, 0, ""},
+	} {
+		if got := bar(st.t, st.longest, st.width); got != st.want {
+			t.Errorf("%s: expected %q, got %q", st.name, st.want, got)
+		}
+	}
+}
@@ -2,67 +2,29 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
-	"net/http"
-	"runtime"
 	"time"
-)
-
-type result struct {
-	url     string
-	err     error
-	latency time.Duration
-}
-
-func get(ctx context.Context, url string, ch chan<- result) {
-	var r result
-	start := time.Now()
-	ticker := time.NewTicker(1 * time.Second).C
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		r = result{
-			url, err, 0,
-		}
-	} else {
-		t := time.Since(start).Round(time.Millisecond)
-		r = result{
-			url, err, t,
-		}
-		resp.Body.Close()
-	}
 
-	for {
-		select {
-		case ch <- r:
-			return
-		case <-ticker:
-			log.Println("tick ", r)
-		}
-	}
-}
-
-// gets the first successful request and returns the response
-func first(ctx context.Context, urls []string) (*result, error) {
-	results := make(chan result, len(urls)) // buffer to avoid leaking
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel() // cancel no matter what to free up resources
-
-	for _, url := range urls {
-		go get(ctx, url, results)
-	}
+	"25/prober"
+)
 
-	select {
-	case r := <-results:
-		return &r, nil
-		// handle the case of the parent contex being cancelled from above
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	}
+// gets the first successful request and returns the response; errors
+// only count when every replica fails, the others are cancelled, and
+// none of them is left running
+func first(ctx context.Context, p *prober.Prober, urls []string) (prober.Winner, error) {
+	w, _, err := p.Race(ctx, urls)
+	return w, err
 }
 
 func main() {
+	rounds := flag.Int("rounds", 20, "how many times to race them")
+	percentile := flag.Float64("percentile", 0.95, "send a backup when the one before is slower than this percentile of the latencies so far")
+	hedge := flag.Duration("hedge", 100*time.Millisecond, "the least to wait before a backup, and all until enough latencies are in")
+	timeout := flag.Duration("timeout", 5*time.Second, "how long a round may take")
+	flag.Parse()
+
+	// the first is the primary, the rest are backups in turn
 	sites := []string{
 		"https://www.amazon.com",
 		"https://www.google.com",
@@ -71,13 +33,40 @@ func main() {
 		"http://localhost:8080/",
 	}
 
-	r, _ := first(context.Background(), sites)
-	if r.err != nil {
-		log.Printf("%-20s %s\n", r.url, r.err)
-	} else {
-		log.Printf("%-20s %s\n", r.url, r.latency)
+	if flag.NArg() > 0 {
+		sites = flag.Args()
 	}
 
-	time.Sleep(9 * time.Second)
-	log.Println("quit anyway... ", runtime.NumGoroutine(), " still running")
+	p := &prober.Prober{
+		Hedge:           *hedge,
+		HedgePercentile: *percentile,
+		Latencies:       &prober.Latencies{},
+	}
+
+	wins := make([]int, len(sites))
+	var sent, extra, failed int
+
+	for range *rounds {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		w, err := first(ctx, p, sites)
+		cancel()
+
+		sent += w.Sent
+		if err != nil {
+			log.Printf("all failed: %s\n", err)
+			failed++
+			continue
+		}
+
+		wins[w.Replica]++
+
+		// only a round with a winner has requests to spare
+		extra += w.Sent - 1
+		log.Printf("%-25s %8s  replica %d, %d extra\n", w.URL, w.Latency.Round(time.Millisecond), w.Replica, w.Sent-1)
+	}
+
+	for i, url := range sites {
+		log.Printf("%-25s won %d\n", url, wins[i])
+	}
+	log.Printf("%d requests for %d rounds, %d extra, %d rounds failed\n", sent, *rounds, extra, failed)
 }
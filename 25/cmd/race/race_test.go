@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"25/prober"
+	"leaktest"
+)
+
+func TestFirst(t *testing.T) {
+	leaktest.Check(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hang":
+			<-r.Context().Done()
+		case "/fail":
+			http.Error(w, "no", http.StatusInternalServerError)
+		default:
+			w.Write([]byte("hello"))
+		}
+	}))
+	defer srv.Close()
+
+	p := &prober.Prober{Hedge: 20 * time.Millisecond, HedgePercentile: 0.95, Latencies: &prober.Latencies{}}
+
+	// the primary hangs, the first backup fails and the second wins;
+	// the one left hanging is cancelled rather than left behind
+	w, err := first(context.Background(), p, []string{srv.URL + "/hang", srv.URL + "/fail", srv.URL + "/ok"})
+	if err != nil || w.Replica != 2 || w.Sent != 3 {
+		t.Errorf("expected the second backup to win, got %d of %d: %v", w.Replica, w.Sent, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := first(ctx, p, []string{srv.URL + "/hang", srv.URL + "/hang"}); err == nil {
+		t.Errorf("expected a timeout")
+	}
+}
@@ -1,3 +1,7 @@
 module 25
 
 go 1.24
+
+require leaktest v0.0.0
+
+replace leaktest => ../leaktest
@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+
+	"25/prober"
+)
+
+// Check is an endpoint and what it has to do to count as up
+type Check struct {
+	URL        string   `json:"url"`
+	Status     []int    `json:"status,omitempty"`      // any of these, or below 400 if none
+	MaxLatency Duration `json:"max_latency,omitempty"` // 0 for no limit
+	Body       string   `json:"body,omitempty"`        // a regexp the start of the body must match
+
+	body *regexp.Regexp
+}
+
+// Duration is written as "500ms" or "1m30s" in JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Load reads a JSON list of checks, e.g.
+//
+//	[{"url": "http://localhost:8080/health", "status": [200], "max_latency": "300ms", "body": "ok"}]
+func Load(path string) ([]*Check, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var checks []*Check
+	if err := json.Unmarshal(data, &checks); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i, c := range checks {
+		if err := c.compile(); err != nil {
+			return nil, fmt.Errorf("%s: check %d: %w", path, i+1, err)
+		}
+	}
+
+	return checks, nil
+}
+
+func (c *Check) compile() error {
+	if c.URL == "" {
+		return errors.New("no url")
+	}
+
+	if c.Body != "" && c.body == nil {
+		re, err := regexp.Compile(c.Body)
+		if err != nil {
+			return err
+		}
+		c.body = re
+	}
+
+	return nil
+}
+
+// Eval says why r fails the check, or nil if it passes
+func (c *Check) Eval(r prober.Result) error {
+	switch {
+	case r.Err != nil:
+		return r.Err
+	case len(c.Status) > 0 && !slices.Contains(c.Status, r.Status):
+		return fmt.Errorf("status %d, expected %v", r.Status, c.Status)
+	case len(c.Status) == 0 && !r.OK():
+		return fmt.Errorf("status %d", r.Status)
+	case c.MaxLatency > 0 && r.Latency > time.Duration(c.MaxLatency):
+		return fmt.Errorf("took %s, more than %s", r.Latency.Round(time.Millisecond), time.Duration(c.MaxLatency))
+	case c.body != nil && !c.body.Match(r.Body):
+		return fmt.Errorf("body doesn't match %q", c.Body)
+	}
+	return nil
+}
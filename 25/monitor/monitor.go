@@ -0,0 +1,155 @@
+// Package monitor probes a list of endpoints on an interval and raises
+// an alert when one goes down or comes back up.
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"25/prober"
+)
+
+// State is whether an endpoint passes its check
+type State int
+
+const (
+	Up State = iota
+	Down
+)
+
+func (s State) String() string {
+	if s == Down {
+		return "down"
+	}
+	return "up"
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Alert is raised when an endpoint changes state
+type Alert struct {
+	URL    string        `json:"url"`
+	State  State         `json:"state"`
+	Since  time.Time     `json:"since"`            // the first check in the new state
+	Checks int           `json:"checks"`           // in a row in the new state
+	Reason string        `json:"reason,omitempty"` // why it's down
+	Result prober.Result `json:"result"`           // the check that decided it
+}
+
+// keep is how much of the body is kept for checks with a regexp, when
+// the Prober doesn't say
+const keep = 1 << 20
+
+type Monitor struct {
+	Checks   []*Check
+	Prober   prober.Prober
+	Interval time.Duration
+
+	// how many checks in a row have to agree before the state changes,
+	// so a single slow or failed request doesn't raise an alert; 1 if 0
+	Confirm int
+
+	// called with each change, from the goroutine running Run
+	Alert func(Alert)
+}
+
+// endpoint is how a check has been going
+type endpoint struct {
+	state  State
+	streak int       // checks in a row that disagree with state
+	since  time.Time // when the streak started
+	reason error     // the last failure
+}
+
+// observe records a check made at a time and says whether the state
+// has changed
+func (e *endpoint) observe(s State, at time.Time, confirm int) bool {
+	if s == e.state {
+		e.streak = 0
+		return false
+	}
+
+	if e.streak == 0 {
+		e.since = at
+	}
+
+	if e.streak++; e.streak < confirm {
+		return false
+	}
+
+	e.state = s
+	e.streak = 0
+	return true
+}
+
+// Run checks every endpoint straight away and then on each tick of the
+// interval until ctx is cancelled. Everything is taken to be up to
+// begin with, so only the ones that aren't raise an alert. A round that
+// takes longer than the interval finds a tick waiting, as the ticker
+// keeps one, so the next starts straight away; the ticks missed
+// meanwhile are dropped rather than run one after another.
+func (m *Monitor) Run(ctx context.Context) error {
+	if m.Interval <= 0 {
+		return errors.New("monitor: no interval")
+	}
+
+	for _, c := range m.Checks {
+		if err := c.compile(); err != nil {
+			return fmt.Errorf("monitor: %s: %w", c.URL, err)
+		}
+	}
+
+	p := m.Prober
+	if p.Keep == 0 && slices.ContainsFunc(m.Checks, func(c *Check) bool { return c.body != nil }) {
+		p.Keep = keep
+	}
+
+	confirm := max(m.Confirm, 1)
+	endpoints := make([]endpoint, len(m.Checks))
+
+	var urls []string
+	for _, c := range m.Checks {
+		urls = append(urls, c.URL)
+	}
+
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		at := time.Now()
+		results := p.All(ctx, urls)
+
+		// requests cut short by stopping say nothing about the endpoints
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		for i, r := range results {
+			e := &endpoints[i]
+
+			s := Up
+			if e.reason = m.Checks[i].Eval(r); e.reason != nil {
+				s = Down
+			}
+
+			if e.observe(s, at, confirm) && m.Alert != nil {
+				a := Alert{URL: r.URL, State: s, Since: e.since, Checks: confirm, Result: r}
+				if s == Down {
+					a.Reason = e.reason.Error()
+				}
+				m.Alert(a)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"25/prober"
+	"leaktest"
+)
+
+func TestEval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checks.json")
+	os.WriteFile(path, []byte(`[
+		{"url": "http://a"},
+		{"url": "http://b", "status": [204, 301], "max_latency": "100ms", "body": "^ok"}
+	]`), 0o644)
+
+	checks, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, strict := checks[0], checks[1]
+	if time.Duration(strict.MaxLatency) != 100*time.Millisecond {
+		t.Errorf("unexpected max latency %s", time.Duration(strict.MaxLatency))
+	}
+
+	for _, st := range []struct {
+		c    *Check
+		r    prober.Result
+		pass bool
+	}{
+		{plain, prober.Result{Status: 200}, true},
+		{plain, prober.Result{Status: 302}, true},
+		{plain, prober.Result{Status: 404}, false},
+		{plain, prober.Result{Err: errors.New("refused")}, false},
+		{plain, prober.Result{Status: 200, Latency: time.Hour}, true},
+		{strict, prober.Result{Status: 204, Body: []byte("ok\n")}, true},
+		{strict, prober.Result{Status: 200, Body: []byte("ok\n")}, false},
+		{strict, prober.Result{Status: 301, Body: []byte("ok"), Latency: time.Second}, false},
+		{strict, prober.Result{Status: 204, Body: []byte("not ok")}, false},
+	} {
+		if err := st.c.Eval(st.r); (err == nil) != st.pass {
+			t.Errorf("%s %+v: expected a pass to be %v, got %v", st.c.URL, st.r, st.pass, err)
+		}
+	}
+
+	for _, bad := range []string{`[{"url": ""}]`, `[{"url": "x", "body": "("}]`, `[{"url": "x", "max_latency": "soon"}]`} {
+		os.WriteFile(path, []byte(bad), 0o644)
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestFlaps(t *testing.T) {
+	var e endpoint
+	start := time.Now()
+
+	// one check down and the next up again changes nothing
+	var changes []State
+	for i, s := range []State{Down, Up, Down, Down, Up, Down, Down, Down, Down, Up, Up, Down, Up, Up, Up} {
+		if e.observe(s, start.Add(time.Duration(i)*time.Second), 3) {
+			changes = append(changes, e.state)
+
+			if want := start.Add(time.Duration(i-2) * time.Second); !e.since.Equal(want) {
+				t.Errorf("%d: expected the change to date from %d", i, i-2)
+			}
+		}
+	}
+
+	if !slices.Equal(changes, []State{Down, Up}) {
+		t.Errorf("expected down and back up, got %v", changes)
+	}
+}
+
+func TestRun(t *testing.T) {
+	leaktest.Check(t)
+
+	var failing atomic.Bool
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.Write([]byte("maintenance"))
+			return
+		}
+		w.Write([]byte("all good"))
+	}))
+	defer site.Close()
+
+	type posted struct {
+		URL    string `json:"url"`
+		State  string `json:"state"`
+		Checks int    `json:"checks"`
+		Reason string `json:"reason"`
+		Result struct {
+			Status int `json:"status"`
+		} `json:"result"`
+	}
+
+	alerts := make(chan posted, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a posted
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Errorf("bad alert: %v", err)
+		}
+		alerts <- a
+	}))
+	defer hook.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := &Monitor{
+		Checks:   []*Check{{URL: site.URL, Body: "good"}},
+		Interval: 5 * time.Millisecond,
+		Confirm:  2,
+	}
+
+	w := &Webhook{URL: hook.URL}
+	m.Alert = func(a Alert) {
+		if err := w.Post(context.Background(), a); err != nil {
+			t.Errorf("post: %v", err)
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- m.Run(ctx) }()
+
+	wait := func(want string) posted {
+		t.Helper()
+		select {
+		case a := <-alerts:
+			if a.State != want || a.URL != site.URL || a.Checks != 2 {
+				t.Errorf("expected %s, got %+v", want, a)
+			}
+			return a
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no alert that it's %s", want)
+			return posted{}
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	failing.Store(true)
+
+	if a := wait("down"); a.Reason != `body doesn't match "good"` || a.Result.Status != 200 {
+		t.Errorf("unexpected reason %q and status %d", a.Reason, a.Result.Status)
+	}
+
+	failing.Store(false)
+	wait("up")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("run: %v", err)
+	}
+
+	select {
+	case a := <-alerts:
+		t.Errorf("unexpected alert %+v", a)
+	default:
+	}
+}
@@ -0,0 +1,54 @@
+package prober
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// enough is how many latencies it takes before Percentile will say
+const enough = 10
+
+// Latencies keeps the last Size latencies to find their percentiles;
+// it's safe to share between goroutines and Probers
+type Latencies struct {
+	Size int // 100 if 0
+
+	mu   sync.Mutex
+	kept []time.Duration
+	next int // the oldest, once there are Size of them
+}
+
+func (l *Latencies) Add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	size := l.Size
+	if size <= 0 {
+		size = 100
+	}
+
+	if len(l.kept) < size {
+		l.kept = append(l.kept, d)
+		return
+	}
+
+	l.kept[l.next%len(l.kept)] = d
+	l.next = (l.next + 1) % len(l.kept)
+}
+
+// Percentile is the latency that a fraction p of them were within,
+// e.g. 0.95, or false while there are too few to tell
+func (l *Latencies) Percentile(p float64) (time.Duration, bool) {
+	l.mu.Lock()
+	sorted := slices.Sorted(slices.Values(l.kept))
+	l.mu.Unlock()
+
+	if len(sorted) < enough {
+		return 0, false
+	}
+
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)], true
+}
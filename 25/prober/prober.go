@@ -0,0 +1,336 @@
+// Package prober fetches a list of URLs concurrently and reports how
+// each went: all of them, the first to succeed, or the first n.
+package prober
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Result is how one request went
+type Result struct {
+	URL     string
+	Status  int           // 0 if there was no response
+	Bytes   int64         // of the body, as far as it was read
+	Body    []byte        // the start of it, if the Prober keeps any
+	Latency time.Duration // until the whole body was read, or the failure
+	Timing  Timing        // where the latency went
+	Err     error
+
+	replica int // which of the urls it was, as one may be there twice
+}
+
+// OK is a response that came back whole with a status below 400
+func (r Result) OK() bool {
+	return r.Err == nil && r.Status >= 200 && r.Status < 400
+}
+
+func (r Result) String() string {
+	if r.Err != nil {
+		return r.Err.Error()
+	}
+	return fmt.Sprintf("%d %d bytes %s", r.Status, r.Bytes, r.Latency)
+}
+
+// with the latency in milliseconds and the error as text
+func (r Result) MarshalJSON() ([]byte, error) {
+	var msg string
+	if r.Err != nil {
+		msg = r.Err.Error()
+	}
+
+	return json.Marshal(struct {
+		URL     string  `json:"url"`
+		Status  int     `json:"status,omitempty"`
+		Bytes   int64   `json:"bytes"`
+		Latency float64 `json:"latency_ms"`
+		Timing  Timing  `json:"timing"`
+		Err     string  `json:"error,omitempty"`
+	}{r.URL, r.Status, r.Bytes, float64(r.Latency.Microseconds()) / 1000, r.Timing, msg})
+}
+
+// ErrNotEnough is returned when too many requests failed for First or
+// Quorum to get what they wanted
+var ErrNotEnough = errors.New("not enough requests succeeded")
+
+type Prober struct {
+	Client *http.Client // http.DefaultClient if nil
+
+	// how long one request may take, 0 for as long as ctx allows
+	Timeout time.Duration
+
+	// how many requests may be out at once, 0 for all of them
+	Concurrency int
+
+	// how much of each body to keep in Result.Body, 0 for none
+	Keep int64
+
+	// First starts one request, then another each time this passes
+	// without an answer, or at once on a failure; 0 starts them all
+	// together
+	Hedge time.Duration
+
+	// with Latencies, First waits for this percentile of the ones seen
+	// so far instead, e.g. 0.95, so only the slowest few get a backup;
+	// Hedge is the least it waits, and all it waits until there are
+	// enough latencies to go on
+	HedgePercentile float64
+
+	// if set, the latency of every OK request is added
+	Latencies *Latencies
+}
+
+// Probe makes one request, reading the whole body
+func (p *Prober) Probe(ctx context.Context, url string) (r Result) {
+	r.URL = url
+	tr := newTracer()
+
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		r.Timing = tr.done()
+		r.Latency = time.Since(tr.start)
+
+		if p.Latencies != nil && r.OK() {
+			p.Latencies.Add(r.Latency)
+		}
+	}()
+
+	ctx = tr.trace(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer resp.Body.Close()
+
+	r.Status = resp.StatusCode
+
+	if p.Keep > 0 {
+		r.Body, r.Err = io.ReadAll(io.LimitReader(resp.Body, p.Keep))
+		r.Bytes = int64(len(r.Body))
+		if r.Err != nil {
+			return r
+		}
+	}
+
+	n, err := io.Copy(io.Discard, resp.Body)
+	r.Bytes += n
+	r.Err = err
+	return r
+}
+
+// Stream starts the requests, no more than Concurrency at a time, and
+// sends each result as it comes in; the channel is closed after the
+// last. Cancelling ctx ends the requests still out, which then come
+// back with its error; none of them is left behind even if nobody
+// reads the channel.
+func (p *Prober) Stream(ctx context.Context, urls []string) <-chan Result {
+	return p.stream(ctx, urls, new(atomic.Int32))
+}
+
+// stream counts the requests it sends
+func (p *Prober) stream(ctx context.Context, urls []string, sent *atomic.Int32) <-chan Result {
+	results := make(chan Result, len(urls))
+
+	limit := p.Concurrency
+	if limit <= 0 || limit > len(urls) {
+		limit = len(urls)
+	}
+	sem := make(chan struct{}, limit)
+
+	var wg sync.WaitGroup
+
+	for i, url := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+				sent.Add(1)
+				r := p.Probe(ctx, url)
+				r.replica = i
+				results <- r
+			case <-ctx.Done():
+				results <- Result{URL: url, Err: ctx.Err(), replica: i}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// All makes every request and returns the results in the order of
+// urls
+func (p *Prober) All(ctx context.Context, urls []string) []Result {
+	out := make([]Result, len(urls))
+	for r := range p.Stream(ctx, urls) {
+		out[r.replica] = r
+	}
+
+	return out
+}
+
+// First returns the first result that's OK and cancels the rest; if
+// none is, it returns ErrNotEnough with all of them
+func (p *Prober) First(ctx context.Context, urls []string) (Result, []Result, error) {
+	w, all, err := p.Race(ctx, urls)
+	return w.Result, all, err
+}
+
+// Winner is the result First returns and what it took to get it
+type Winner struct {
+	Result
+	Replica int // which of the urls it is, -1 if none was OK
+	Sent    int // requests started, so all but one were spent for nothing
+}
+
+// Race is First, saying which replica won and how many requests it
+// took
+func (p *Prober) Race(ctx context.Context, urls []string) (Winner, []Result, error) {
+	var sent atomic.Int32
+	ok, all, err := p.quorum(ctx, urls, 1, &sent)
+
+	w := Winner{Replica: -1, Sent: int(sent.Load())}
+	if err != nil {
+		return w, all, err
+	}
+
+	w.Result = ok[0]
+	w.Replica = w.replica
+	return w, all, nil
+}
+
+// Quorum returns as soon as n of the requests are OK, cancelling the
+// rest, or ErrNotEnough once too many have failed for that; all is
+// every result that came in before it returned
+func (p *Prober) Quorum(ctx context.Context, urls []string, n int) (ok, all []Result, err error) {
+	return p.quorum(ctx, urls, n, new(atomic.Int32))
+}
+
+func (p *Prober) quorum(ctx context.Context, urls []string, n int, sent *atomic.Int32) (ok, all []Result, err error) {
+	if n <= 0 || n > len(urls) {
+		return nil, nil, fmt.Errorf("quorum of %d out of %d", n, len(urls))
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // the ones still out stop and are thrown away
+
+	var results <-chan Result
+	if hedge := p.hedge(); hedge > 0 {
+		results = p.hedged(ctx, urls, hedge, sent)
+	} else {
+		results = p.stream(ctx, urls, sent)
+	}
+
+	failed := 0
+
+	for r := range results {
+		all = append(all, r)
+
+		if r.OK() {
+			if ok = append(ok, r); len(ok) == n {
+				return ok, all, nil
+			}
+			continue
+		}
+
+		if failed++; failed > len(urls)-n {
+			break
+		}
+	}
+
+	if err := parent.Err(); err != nil {
+		return ok, all, fmt.Errorf("%w: %w", ErrNotEnough, err)
+	}
+	return ok, all, ErrNotEnough
+}
+
+// hedge is how long to wait before a backup request, 0 for not at all
+func (p *Prober) hedge() time.Duration {
+	if p.Latencies != nil && p.HedgePercentile > 0 {
+		if d, ok := p.Latencies.Percentile(p.HedgePercentile); ok {
+			return max(d, p.Hedge)
+		}
+	}
+	return p.Hedge
+}
+
+// hedged starts the requests one after another, the next when hedge
+// passes or the last one fails, until ctx is cancelled
+func (p *Prober) hedged(ctx context.Context, urls []string, hedge time.Duration, sent *atomic.Int32) <-chan Result {
+	results := make(chan Result, len(urls))
+	failed := make(chan struct{}, len(urls))
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i, url := range urls {
+			if i > 0 {
+				timer := time.NewTimer(hedge)
+				select {
+				case <-timer.C:
+				case <-failed:
+					timer.Stop()
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				}
+			}
+
+			wg.Add(1)
+			sent.Add(1)
+			go func() {
+				defer wg.Done()
+
+				r := p.Probe(ctx, url)
+				r.replica = i
+				if !r.OK() {
+					failed <- struct{}{}
+				}
+				results <- r
+			}()
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
@@ -0,0 +1,434 @@
+package prober
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"leaktest"
+)
+
+// sites serves /fast, /slow, /fail, /cut and /hang, counting requests and
+// noticing when one is given up on
+type sites struct {
+	*httptest.Server
+	mu        sync.Mutex
+	hits      map[string]int
+	cancelled atomic.Int32
+	inFlight  atomic.Int32
+	most      atomic.Int32
+}
+
+func newSites(t *testing.T) *sites {
+	s := &sites{hits: make(map[string]int)}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.hits[r.URL.Path]++
+		s.mu.Unlock()
+
+		n := s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		for m := s.most.Load(); n > m && !s.most.CompareAndSwap(m, n); m = s.most.Load() {
+		}
+
+		wait := map[string]time.Duration{"/fast": 0, "/slow": 100 * time.Millisecond, "/hang": time.Hour}[r.URL.Path]
+		if strings.HasPrefix(r.URL.Path, "/busy") {
+			wait = 20 * time.Millisecond
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			s.cancelled.Add(1)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/fail":
+			http.Error(w, "no", http.StatusInternalServerError)
+			return
+		case "/cut":
+			// promise more than we send, so reading the body fails
+			w.Header().Set("Content-Length", "100")
+		}
+		w.Write([]byte("hello"))
+	}))
+
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *sites) urls(paths ...string) []string {
+	var out []string
+	for _, p := range paths {
+		out = append(out, s.URL+p)
+	}
+	return out
+}
+
+func (s *sites) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+func TestAll(t *testing.T) {
+	leaktest.Check(t)
+
+	s := newSites(t)
+	var p Prober
+
+	rs := p.All(context.Background(), s.urls("/slow", "/fast", "/fail", "/fast"))
+
+	for i, want := range []int{200, 200, 500, 200} {
+		if rs[i].Status != want || rs[i].Err != nil {
+			t.Errorf("%d: expected %d, got %v", i, want, rs[i])
+		}
+	}
+
+	if !rs[0].OK() || rs[0].Bytes != 5 || rs[0].Latency < 100*time.Millisecond {
+		t.Errorf("unexpected %+v", rs[0])
+	}
+
+	if rs[2].OK() {
+		t.Errorf("a 500 isn't OK")
+	}
+
+	// a bad body or URL is reported like any other error
+	rs = p.All(context.Background(), append(s.urls("/cut"), "http://bad url"))
+
+	if rs[0].Err == nil || rs[0].Status != 200 || rs[0].Bytes != 5 {
+		t.Errorf("expected /cut to fail after 5 bytes, got %+v", rs[0])
+	}
+
+	if rs[1].Err == nil || rs[1].URL != "http://bad url" {
+		t.Errorf("expected a bad URL to fail, got %+v", rs[1])
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	leaktest.Check(t)
+
+	s := newSites(t)
+
+	// each request gets so long
+	p := Prober{Timeout: 50 * time.Millisecond}
+	rs := p.All(context.Background(), s.urls("/fast", "/slow"))
+
+	if !rs[0].OK() || !errors.Is(rs[1].Err, context.DeadlineExceeded) {
+		t.Errorf("expected only /slow to time out, got %v and %v", rs[0], rs[1])
+	}
+
+	// and all of them together, including one never started
+	p = Prober{Concurrency: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	rs = p.All(ctx, s.urls("/hang", "/hang"))
+	for _, r := range rs {
+		if !errors.Is(r.Err, context.DeadlineExceeded) {
+			t.Errorf("expected a timeout, got %v", r)
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	leaktest.Check(t)
+
+	s := newSites(t)
+	p := Prober{Concurrency: 3}
+
+	urls := s.urls("/busy1", "/busy2", "/busy3", "/busy4", "/busy5", "/busy6", "/busy7")
+	for _, r := range p.All(context.Background(), urls) {
+		if !r.OK() {
+			t.Errorf("%v", r)
+		}
+	}
+
+	if m := s.most.Load(); m != 3 {
+		t.Errorf("expected 3 requests at once at most, got %d", m)
+	}
+}
+
+func TestFirst(t *testing.T) {
+	leaktest.Check(t)
+
+	s := newSites(t)
+	var p Prober
+
+	r, all, err := p.First(context.Background(), s.urls("/hang", "/fail", "/slow"))
+	if err != nil || r.URL != s.URL+"/slow" || len(all) != 2 {
+		t.Fatalf("expected /slow after /fail, got %v %d %v", r, len(all), err)
+	}
+
+	// the one still out is let go
+	deadline := time.Now().Add(time.Second)
+	for s.cancelled.Load() != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := s.cancelled.Load(); n != 1 {
+		t.Errorf("expected /hang to be cancelled, got %d cancelled", n)
+	}
+
+	_, all, err = p.First(context.Background(), s.urls("/fail", "/fail"))
+	if !errors.Is(err, ErrNotEnough) || len(all) != 2 {
+		t.Errorf("expected both to fail, got %d and %v", len(all), err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, _, err := p.First(ctx, s.urls("/hang")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestHedge(t *testing.T) {
+	leaktest.Check(t)
+
+	s := newSites(t)
+	p := Prober{Hedge: 50 * time.Millisecond}
+
+	// the first answers in time, so the second is never asked
+	r, _, err := p.First(context.Background(), s.urls("/fast", "/slow"))
+	if err != nil || r.URL != s.URL+"/fast" {
+		t.Fatalf("expected /fast, got %v %v", r, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := s.count("/slow"); n != 0 {
+		t.Errorf("expected no request for /slow, got %d", n)
+	}
+
+	// a slow one gets a backup after the hedge, a failure at once
+	start := time.Now()
+	r, all, err := p.First(context.Background(), s.urls("/hang", "/fail", "/fast"))
+	if err != nil || r.URL != s.URL+"/fast" || len(all) != 2 {
+		t.Fatalf("expected /fast after /fail, got %v %d %v", r, len(all), err)
+	}
+
+	if d := time.Since(start); d < 50*time.Millisecond || d > 90*time.Millisecond {
+		t.Errorf("expected one hedge's wait, took %s", d)
+	}
+}
+
+func TestLatencies(t *testing.T) {
+	l := &Latencies{Size: 20}
+
+	for i := 1; i <= 9; i++ {
+		l.Add(time.Duration(i) * time.Millisecond)
+	}
+	if _, ok := l.Percentile(0.5); ok {
+		t.Errorf("expected too few to tell")
+	}
+
+	// 1ms to 30ms, of which only the last 20 are kept
+	for i := 10; i <= 30; i++ {
+		l.Add(time.Duration(i) * time.Millisecond)
+	}
+
+	for p, want := range map[float64]time.Duration{0: 11, 0.5: 20, 0.95: 29, 1: 30} {
+		if d, ok := l.Percentile(p); !ok || d != want*time.Millisecond {
+			t.Errorf("%v: expected %dms, got %s", p, want, d)
+		}
+	}
+}
+
+func TestRace(t *testing.T) {
+	leaktest.Check(t)
+
+	s := newSites(t)
+	l := &Latencies{}
+	p := Prober{Hedge: 50 * time.Millisecond, HedgePercentile: 0.9, Latencies: l}
+
+	// until it has seen enough, it waits for Hedge
+	for range 10 {
+		w, _, err := p.Race(context.Background(), s.urls("/fast", "/slow"))
+		if err != nil || w.Replica != 0 || w.Sent != 1 {
+			t.Fatalf("expected /fast alone, got %d of %d: %v", w.Replica, w.Sent, err)
+		}
+	}
+
+	// then for the 90th percentile, here 20ms, no less than Hedge
+	p.Hedge = 5 * time.Millisecond
+	l.Add(30 * time.Millisecond)
+	for range 10 {
+		l.Add(20 * time.Millisecond)
+	}
+
+	start := time.Now()
+	w, _, err := p.Race(context.Background(), s.urls("/slow", "/fail", "/fast"))
+	if err != nil || w.Replica != 2 || w.URL != s.URL+"/fast" || w.Sent != 3 {
+		t.Fatalf("expected /fast after /fail, got %d of %d: %v", w.Replica, w.Sent, err)
+	}
+
+	if d := time.Since(start); d < 20*time.Millisecond || d > 60*time.Millisecond {
+		t.Errorf("expected to wait the 90th percentile, took %s", d)
+	}
+
+	// a url given twice is credited to the copy that answered
+	var once atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !once.Swap(true) {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	w, _, err = p.Race(context.Background(), []string{srv.URL, srv.URL})
+	if err != nil || w.Replica != 1 || w.Sent != 2 {
+		t.Fatalf("expected the second copy to win, got %d of %d: %v", w.Replica, w.Sent, err)
+	}
+
+	// errors only count when they're all there is
+	w, all, err := p.Race(context.Background(), s.urls("/fail", "/fail"))
+	if !errors.Is(err, ErrNotEnough) || w.Replica != -1 || w.Sent != 2 || len(all) != 2 {
+		t.Errorf("expected both to fail, got %d of %d: %v", w.Replica, w.Sent, err)
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	leaktest.Check(t)
+
+	s := newSites(t)
+	var p Prober
+
+	ok, _, err := p.Quorum(context.Background(), s.urls("/fast", "/slow", "/fail", "/fast", "/hang"), 3)
+	if err != nil || len(ok) != 3 || ok[2].URL != s.URL+"/slow" {
+		t.Errorf("expected the two /fast then /slow, got %v %v", ok, err)
+	}
+
+	// once two of three fail, two can't succeed
+	start := time.Now()
+	_, all, err := p.Quorum(context.Background(), s.urls("/fail", "/hang", "/fail"), 2)
+	if !errors.Is(err, ErrNotEnough) || len(all) != 2 || time.Since(start) > time.Second {
+		t.Errorf("expected to give up after two failures, got %d and %v", len(all), err)
+	}
+
+	if _, _, err := p.Quorum(context.Background(), s.urls("/fast"), 2); err == nil {
+		t.Errorf("expected an error for a quorum of 2 out of 1")
+	}
+}
+
+func TestTracer(t *testing.T) {
+	at := time.Unix(0, 0)
+	tr := &tracer{now: func() time.Time { return at }, start: at}
+	step := func(d time.Duration) { at = at.Add(d * time.Millisecond) }
+
+	ct := httptrace.ContextClientTrace(tr.trace(context.Background()))
+
+	ct.DNSStart(httptrace.DNSStartInfo{})
+	step(2)
+	ct.DNSDone(httptrace.DNSDoneInfo{})
+
+	// two addresses tried, the first start and the last end count
+	ct.ConnectStart("tcp", "[::1]:443")
+	step(1)
+	ct.ConnectStart("tcp", "127.0.0.1:443")
+	ct.ConnectDone("tcp", "[::1]:443", errors.New("refused"))
+	step(3)
+	ct.ConnectDone("tcp", "127.0.0.1:443", nil)
+
+	ct.TLSHandshakeStart()
+	step(5)
+	ct.TLSHandshakeDone(tls.ConnectionState{}, nil)
+	ct.GotConn(httptrace.GotConnInfo{})
+
+	step(1)
+	ct.WroteRequest(httptrace.WroteRequestInfo{})
+	step(30)
+	ct.GotFirstResponseByte()
+	step(20)
+
+	ms := time.Millisecond
+	want := Timing{
+		DNS:      Span{0, 2 * ms},
+		Connect:  Span{2 * ms, 6 * ms},
+		TLS:      Span{6 * ms, 11 * ms},
+		Wait:     Span{12 * ms, 42 * ms},
+		Transfer: Span{42 * ms, 62 * ms},
+	}
+
+	if got := tr.done(); got != want || got.TTFB() != 42*ms {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	// a kept connection skips straight to the request
+	at = time.Unix(0, 0)
+	tr = &tracer{now: func() time.Time { return at }, start: at}
+	ct = httptrace.ContextClientTrace(tr.trace(context.Background()))
+
+	ct.GotConn(httptrace.GotConnInfo{Reused: true})
+	ct.WroteRequest(httptrace.WroteRequestInfo{})
+	step(10)
+	ct.GotFirstResponseByte()
+
+	want = Timing{Wait: Span{0, 10 * ms}, Transfer: Span{10 * ms, 10 * ms}, Reused: true}
+	if got := tr.done(); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestTiming(t *testing.T) {
+	leaktest.Check(t)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(" world"))
+	}))
+	defer srv.Close()
+
+	p := Prober{Client: srv.Client()}
+	r := p.Probe(context.Background(), srv.URL)
+	tm := r.Timing
+
+	if !r.OK() || r.Bytes != 11 {
+		t.Fatalf("unexpected %v", r)
+	}
+
+	// an IP address needs no lookup
+	if tm.DNS != (Span{}) || tm.Connect.Duration() <= 0 || tm.TLS.Duration() <= 0 || tm.Reused {
+		t.Errorf("unexpected connection %+v", tm)
+	}
+
+	if tm.TLS.Start < tm.Connect.End || tm.Wait.Start < tm.TLS.End {
+		t.Errorf("steps out of order %+v", tm)
+	}
+
+	// nothing comes back before the first sleep is over, nor is the
+	// body done before the second; how the steps are worked out is
+	// left to TestTracer, with a clock that can be trusted
+	if tm.Wait.Duration() < 30*time.Millisecond || tm.Transfer.End < 50*time.Millisecond {
+		t.Errorf("expected 30ms waiting and 50ms in all, got %+v", tm)
+	}
+
+	if tm.TTFB() > r.Latency || tm.Transfer.End > r.Latency {
+		t.Errorf("steps past the end %+v of %s", tm, r.Latency)
+	}
+
+	// the second time the connection is kept
+	tm = p.Probe(context.Background(), srv.URL).Timing
+	if !tm.Reused || tm.Connect != (Span{}) || tm.TLS != (Span{}) {
+		t.Errorf("expected a reused connection, got %+v", tm)
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil || !strings.Contains(string(data), `"tls":{"start_ms":`) || strings.Contains(string(data), `"error"`) {
+		t.Errorf("unexpected JSON %s: %v", data, err)
+	}
+}
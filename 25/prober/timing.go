@@ -0,0 +1,100 @@
+package prober
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Span is a step of a request, from when it started to when it ended,
+// both counted from the start of the request; zero if it didn't happen,
+// like DNS for an IP address or anything on a reused connection
+type Span struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+func (s Span) Duration() time.Duration {
+	return s.End - s.Start
+}
+
+// in milliseconds, which is what people read
+func (s Span) MarshalJSON() ([]byte, error) {
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return json.Marshal(struct {
+		Start    float64 `json:"start_ms"`
+		Duration float64 `json:"ms"`
+	}{ms(s.Start), ms(s.Duration())})
+}
+
+// Timing breaks a request down into its steps
+type Timing struct {
+	DNS      Span `json:"dns"`
+	Connect  Span `json:"connect"`
+	TLS      Span `json:"tls"`
+	Wait     Span `json:"wait"`     // from the request sent to the first byte back
+	Transfer Span `json:"transfer"` // the rest of the body
+	Reused   bool `json:"reused"`   // a connection kept from before
+}
+
+// TTFB is the time to the first byte of the response
+func (t Timing) TTFB() time.Duration {
+	return t.Wait.End
+}
+
+// tracer fills in a Timing from the hooks httptrace calls, which may
+// come from more than one goroutine while dialing
+type tracer struct {
+	mu    sync.Mutex
+	now   func() time.Time // time.Now but in tests
+	start time.Time
+	t     Timing
+}
+
+func newTracer() *tracer {
+	return &tracer{now: time.Now, start: time.Now()}
+}
+
+func (tr *tracer) mark(d *time.Duration, once bool) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	// with more than one address to try, the first start and the last
+	// end count
+	if once && *d != 0 {
+		return
+	}
+	*d = tr.now().Sub(tr.start)
+}
+
+func (tr *tracer) trace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { tr.mark(&tr.t.DNS.Start, true) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { tr.mark(&tr.t.DNS.End, false) },
+		ConnectStart:      func(string, string) { tr.mark(&tr.t.Connect.Start, true) },
+		ConnectDone:       func(string, string, error) { tr.mark(&tr.t.Connect.End, false) },
+		TLSHandshakeStart: func() { tr.mark(&tr.t.TLS.Start, true) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { tr.mark(&tr.t.TLS.End, false) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			tr.mu.Lock()
+			tr.t.Reused = info.Reused
+			tr.mu.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { tr.mark(&tr.t.Wait.Start, true) },
+		GotFirstResponseByte: func() { tr.mark(&tr.t.Wait.End, true) },
+	})
+}
+
+// done ends the transfer, and the timing with it
+func (tr *tracer) done() Timing {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if tr.t.Wait.End != 0 {
+		tr.t.Transfer = Span{tr.t.Wait.End, tr.now().Sub(tr.start)}
+	}
+	return tr.t
+}
@@ -0,0 +1,179 @@
+// Package adaptive limits the number of file reads in flight. The fixed
+// limiter is the counting semaphore from the notes; the AIMD limiter
+// moves its limit at runtime, following the throughput it observes.
+package adaptive
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type Limiter interface {
+	// Acquire waits for a slot, or until ctx is done
+	Acquire(ctx context.Context) error
+
+	// Release frees a slot, reporting how many bytes were read with it
+	Release(bytes int64)
+}
+
+type fixed chan any
+
+// NewFixed returns a counting semaphore with n slots
+func NewFixed(n int) Limiter {
+	return make(fixed, n)
+}
+
+func (f fixed) Acquire(ctx context.Context) error {
+	select {
+	case f <- nil:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f fixed) Release(int64) {
+	<-f
+}
+
+type Options struct {
+	Min, Max int           // bounds on the limit
+	Start    int           // the initial limit
+	Window   time.Duration // how often to look at the throughput
+	Drop     float64       // a fall in throughput that counts as contention, e.g. 0.1
+	Backoff  float64       // what to multiply the limit by on contention, e.g. 0.75
+}
+
+var DefaultOptions = Options{
+	Min:     1,
+	Max:     256,
+	Start:   4,
+	Window:  200 * time.Millisecond,
+	Drop:    0.1,
+	Backoff: 0.75,
+}
+
+// AIMD grows its limit by one each window in which it was the
+// bottleneck (every slot was in use) and cuts it back when the
+// throughput falls, like TCP does with its congestion window
+type AIMD struct {
+	opts Options
+
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	wake     chan struct{} // closed & replaced to wake up waiters
+
+	// the current window
+	start     time.Time
+	bytes     int64
+	saturated bool
+
+	avg      float64 // moving average of the throughput in bytes/s
+	cooldown bool    // skip a window after backing off
+}
+
+func NewAIMD(opts Options) *AIMD {
+	return &AIMD{
+		opts:  opts,
+		limit: max(opts.Min, min(opts.Start, opts.Max)),
+		wake:  make(chan struct{}),
+		start: time.Now(),
+	}
+}
+
+func (a *AIMD) Acquire(ctx context.Context) error {
+	for {
+		a.mu.Lock()
+
+		if a.inFlight < a.limit {
+			a.inFlight++
+
+			if a.inFlight == a.limit {
+				a.saturated = true
+			}
+
+			a.mu.Unlock()
+			return nil
+		}
+
+		wake := a.wake
+		a.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (a *AIMD) Release(bytes int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.inFlight--
+	a.bytes += bytes
+
+	if elapsed := time.Since(a.start); elapsed >= a.opts.Window {
+		a.adjust(float64(a.bytes) / elapsed.Seconds())
+	}
+
+	close(a.wake)
+	a.wake = make(chan struct{})
+}
+
+// Limit returns the current limit
+func (a *AIMD) Limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.limit
+}
+
+// adjust is called with the lock held at the end of each window
+func (a *AIMD) adjust(rate float64) {
+	switch {
+	case a.cooldown || a.avg == 0:
+		// start again from what we get at the new limit
+		a.cooldown = false
+		a.avg = rate
+	case rate < a.avg*(1-a.opts.Drop):
+		a.limit = max(a.opts.Min, int(float64(a.limit)*a.opts.Backoff))
+		a.cooldown = true
+	default:
+		if a.saturated && a.limit < a.opts.Max {
+			a.limit++
+		}
+		a.avg = (3*a.avg + rate) / 4
+	}
+
+	a.start = time.Now()
+	a.bytes = 0
+	a.saturated = a.inFlight >= a.limit
+}
+
+// Group keeps a separate limiter per key, such as a device or a root
+// directory, so a slow disk doesn't hold back a fast one
+type Group struct {
+	mu         sync.Mutex
+	newLimiter func() Limiter
+	limits     map[string]Limiter
+}
+
+func NewGroup(newLimiter func() Limiter) *Group {
+	return &Group{newLimiter: newLimiter, limits: map[string]Limiter{}}
+}
+
+func (g *Group) For(key string) Limiter {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	l, ok := g.limits[key]
+	if !ok {
+		l = g.newLimiter()
+		g.limits[key] = l
+	}
+
+	return l
+}
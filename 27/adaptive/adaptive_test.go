@@ -0,0 +1,110 @@
+package adaptive
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFixed(t *testing.T) {
+	lim := NewFixed(2)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	lim.Acquire(ctx)
+	lim.Acquire(ctx)
+
+	if err := lim.Acquire(ctx); err == nil {
+		t.Fatalf("expected the third acquire to time out")
+	}
+
+	lim.Release(0)
+
+	if err := lim.Acquire(context.Background()); err != nil {
+		t.Fatalf("expected a slot after release: %s", err)
+	}
+}
+
+// window runs one measurement window, keeping the limiter saturated
+// and reporting the given number of bytes
+func window(a *AIMD, bytes int64) {
+	n := a.Limit()
+	for range n {
+		a.Acquire(context.Background())
+	}
+
+	for range n - 1 {
+		a.Release(0)
+	}
+
+	// pretend the window is over before the last release
+	a.start = time.Now().Add(-a.opts.Window)
+	a.Release(bytes)
+}
+
+func TestAIMD(t *testing.T) {
+	opts := DefaultOptions
+	opts.Start = 4
+	a := NewAIMD(opts)
+
+	// the first window just sets the baseline
+	window(a, 1000)
+
+	for range 3 {
+		window(a, 1000)
+	}
+
+	if got := a.Limit(); got != 7 {
+		t.Fatalf("expected additive increase to 7, got %d", got)
+	}
+
+	// a big drop in throughput should cut the limit back
+	window(a, 500)
+
+	if got := a.Limit(); got != 5 {
+		t.Fatalf("expected multiplicative decrease to 5, got %d", got)
+	}
+
+	// the window after backing off only resets the baseline
+	window(a, 500)
+	if got := a.Limit(); got != 5 {
+		t.Fatalf("expected no change while cooling down, got %d", got)
+	}
+
+	window(a, 500)
+	if got := a.Limit(); got != 6 {
+		t.Fatalf("expected growth from the new baseline, got %d", got)
+	}
+}
+
+func TestAIMDCancel(t *testing.T) {
+	opts := DefaultOptions
+	opts.Start, opts.Max = 1, 1
+	a := NewAIMD(opts)
+	a.Acquire(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- a.Acquire(ctx)
+	}()
+
+	cancel()
+
+	if err := <-done; err == nil {
+		t.Fatalf("expected the blocked acquire to be cancelled")
+	}
+}
+
+func TestGroup(t *testing.T) {
+	g := NewGroup(func() Limiter { return NewFixed(1) })
+
+	if g.For("a") != g.For("a") {
+		t.Errorf("expected the same limiter for the same key")
+	}
+
+	if g.For("a") == g.For("b") {
+		t.Errorf("expected separate limiters per key")
+	}
+}
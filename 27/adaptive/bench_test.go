@@ -0,0 +1,193 @@
+package adaptive
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// makeTree generates a synthetic tree under dir: depth levels of fanout
+// directories, each holding files of random sizes up to maxSize, with
+// about one file in ten a copy of an earlier one
+func makeTree(b *testing.B, dir string, depth, fanout, files, maxSize int) []string {
+	b.Helper()
+
+	rnd := rand.New(rand.NewSource(27))
+	var paths []string
+	var datas [][]byte
+
+	var fill func(dir string, level int)
+	fill = func(dir string, level int) {
+		for i := range files {
+			var data []byte
+
+			if len(datas) > 0 && rnd.Intn(10) == 0 {
+				data = datas[rnd.Intn(len(datas))]
+			} else {
+				data = make([]byte, 1+rnd.Intn(maxSize))
+				rnd.Read(data)
+				datas = append(datas, data)
+			}
+
+			path := filepath.Join(dir, fmt.Sprintf("f%d", i))
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				b.Fatal(err)
+			}
+			paths = append(paths, path)
+		}
+
+		if level == depth {
+			return
+		}
+
+		for i := range fanout {
+			sub := filepath.Join(dir, fmt.Sprintf("d%d", i))
+			if err := os.Mkdir(sub, 0o755); err != nil {
+				b.Fatal(err)
+			}
+			fill(sub, level+1)
+		}
+	}
+
+	fill(dir, 0)
+	return paths
+}
+
+// contended simulates a disk that slows down when it has more than
+// knee reads in flight, which is what the notes saw with too many workers
+type contended struct {
+	inFlight atomic.Int64
+	knee     int64
+	perRead  time.Duration
+}
+
+func (c *contended) open(fsys fs.FS, name string) (io.ReadCloser, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.inFlight.Add(1)
+	return &slowFile{f, c}, nil
+}
+
+type slowFile struct {
+	fs.File
+	c *contended
+}
+
+func (s *slowFile) Read(p []byte) (int, error) {
+	n := s.c.inFlight.Load()
+	delay := s.c.perRead
+
+	// past the knee each read gets slower faster than the
+	// reads in flight grow, so throughput drops
+	if n > s.c.knee {
+		delay = delay * time.Duration(n*n) / time.Duration(s.c.knee*s.c.knee)
+	}
+
+	time.Sleep(delay)
+	return s.File.Read(p)
+}
+
+func (s *slowFile) Close() error {
+	s.c.inFlight.Add(-1)
+	return s.File.Close()
+}
+
+// hashAll hashes every file with one goroutine per file, like the
+// semaphore finder, holding a slot of lim for each read
+func hashAll(b *testing.B, paths []string, lim Limiter,
+	open func(string) (io.ReadCloser, error)) int64 {
+
+	var wg sync.WaitGroup
+	var total atomic.Int64
+
+	for _, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lim.Acquire(context.Background())
+
+			f, err := open(path)
+			if err != nil {
+				b.Error(err)
+				lim.Release(0)
+				return
+			}
+			defer f.Close()
+
+			n, _ := io.Copy(md5.New(), f)
+			lim.Release(n)
+			total.Add(n)
+		}()
+	}
+
+	wg.Wait()
+	return total.Load()
+}
+
+type strategy struct {
+	name string
+	lim  func() Limiter
+}
+
+// the fixed limits the finders used to have, and the adaptive one
+var strategies = []strategy{
+	{"fixed-1", func() Limiter { return NewFixed(1) }},
+	{"gomaxprocs", func() Limiter { return NewFixed(2 * runtime.GOMAXPROCS(0)) }},
+	{"fixed-32", func() Limiter { return NewFixed(32) }},
+	{"fixed-256", func() Limiter { return NewFixed(256) }},
+	{"aimd", func() Limiter { return NewAIMD(DefaultOptions) }},
+}
+
+// BenchmarkTree hashes a real tree on disk; once it's in the page
+// cache this mostly measures CPU, where the limit matters less
+func BenchmarkTree(b *testing.B) {
+	dir := b.TempDir()
+	paths := makeTree(b, dir, 3, 4, 8, 256<<10)
+
+	open := func(path string) (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+
+	for _, st := range strategies {
+		b.Run(st.name, func(b *testing.B) {
+			for range b.N {
+				b.SetBytes(hashAll(b, paths, st.lim(), open))
+			}
+		})
+	}
+}
+
+// BenchmarkContended hashes the same kind of tree through a simulated
+// disk that gets slower past 8 concurrent reads
+func BenchmarkContended(b *testing.B) {
+	dir := b.TempDir()
+	paths := makeTree(b, dir, 2, 4, 8, 64<<10)
+	fsys := os.DirFS(dir)
+	disk := &contended{knee: 8, perRead: 100 * time.Microsecond}
+
+	open := func(path string) (io.ReadCloser, error) {
+		rel, _ := filepath.Rel(dir, path)
+		return disk.open(fsys, filepath.ToSlash(rel))
+	}
+
+	for _, st := range strategies {
+		b.Run(st.name, func(b *testing.B) {
+			for range b.N {
+				b.SetBytes(hashAll(b, paths, st.lim(), open))
+			}
+		})
+	}
+}
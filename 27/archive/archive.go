@@ -0,0 +1,223 @@
+// Package archive opens zip and tar backups as file systems, so that
+// their members can be hashed like any other file. A member is named by
+// the archive's path, "!/" and its path inside, e.g.
+// backup.zip!/docs/a.pdf.
+package archive
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Sep separates an archive's path from a member's path inside it
+const Sep = "!/"
+
+// Is reports whether path looks like an archive we can open
+func Is(path string) bool {
+	name := strings.ToLower(path)
+
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz", ".gz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Split separates a member path into the archive and the member's
+// slash-separated path inside it. Only a regular file that Is an
+// archive counts, so a file under a directory called "old!" is just a
+// file.
+func Split(path string) (archive, member string, ok bool) {
+	for i := 0; ; i += len(Sep) {
+		j := strings.Index(path[i:], Sep)
+		if j < 0 {
+			return "", "", false
+		}
+
+		i += j
+		if archive = path[:i]; !Is(archive) {
+			continue
+		}
+
+		if info, err := os.Stat(archive); err == nil && info.Mode().IsRegular() {
+			return archive, path[i+len(Sep):], true
+		}
+	}
+}
+
+// FS is an opened archive, to be closed after use
+type FS struct {
+	fs.FS
+	close func() error
+}
+
+func (a *FS) Close() error {
+	return a.close()
+}
+
+// OpenFS opens the archive at path
+func OpenFS(path string) (*FS, error) {
+	name := strings.ToLower(path)
+
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		return &FS{r, r.Close}, nil
+
+	case strings.HasSuffix(name, ".tar"):
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		tfs, err := newTarFS(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &FS{tfs, f.Close}, nil
+
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return openGzip(path, true)
+
+	case strings.HasSuffix(name, ".gz"):
+		return openGzip(path, false)
+	}
+
+	return nil, errors.New("not an archive")
+}
+
+// Index remembers the members walked through it, so that a report can
+// stat them without unpacking their archive again. It belongs to one
+// scan and goes with it; a nil Index remembers nothing.
+type Index struct {
+	infos sync.Map // member path -> fs.FileInfo
+}
+
+// Walk calls fn for every regular file in the archive, with its full
+// member path. Archives inside archives are hashed as they are, not
+// opened.
+func Walk(path string, fn func(member string, f fs.File, info fs.FileInfo) error) error {
+	return (*Index)(nil).Walk(path, fn)
+}
+
+// Forget drops the members of the archive at path, or of every archive
+// under it if it's a directory, e.g. once it's changed or gone
+func (x *Index) Forget(path string) {
+	path = filepath.Clean(path)
+	inArchive, inDir := path+Sep, path+string(filepath.Separator)
+
+	x.infos.Range(func(key, _ any) bool {
+		if k := key.(string); strings.HasPrefix(k, inArchive) || strings.HasPrefix(k, inDir) {
+			x.infos.Delete(key)
+		}
+		return true
+	})
+}
+
+// Walk is the package's Walk, remembering the members it finds
+func (x *Index) Walk(path string, fn func(member string, f fs.File, info fs.FileInfo) error) error {
+	a, err := OpenFS(path)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	return fs.WalkDir(a, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		f, err := a.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		member := path + Sep + name
+		if x != nil {
+			x.infos.Store(member, info)
+		}
+
+		return fn(member, f, info)
+	})
+}
+
+// Open opens a file, which may be an archive member
+func Open(path string) (io.ReadCloser, error) {
+	arch, member, ok := Split(path)
+	if !ok {
+		return os.Open(path)
+	}
+
+	a, err := OpenFS(arch)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := a.Open(member)
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+
+	return &memberFile{f, a}, nil
+}
+
+type memberFile struct {
+	fs.File
+	a *FS
+}
+
+func (m *memberFile) Close() error {
+	m.File.Close()
+	return m.a.Close()
+}
+
+// Stat is os.Stat for paths that may be archive members
+func Stat(path string) (fs.FileInfo, error) {
+	return (*Index)(nil).Stat(path)
+}
+
+// Stat is the package's Stat, without opening the archive for the
+// members walked through x
+func (x *Index) Stat(path string) (fs.FileInfo, error) {
+	if x != nil {
+		if info, ok := x.infos.Load(path); ok {
+			return info.(fs.FileInfo), nil
+		}
+	}
+
+	arch, member, ok := Split(path)
+	if !ok {
+		return os.Stat(path)
+	}
+
+	a, err := OpenFS(arch)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+
+	return fs.Stat(a, member)
+}
@@ -0,0 +1,191 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var members = map[string]string{
+	"docs/a.pdf":      "report",
+	"docs/deep/b.txt": "notes",
+	"c.txt":           "more notes",
+}
+
+func writeZip(t *testing.T, path string) {
+	f, _ := os.Create(path)
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, data := range members {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, data)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTar(t *testing.T, w io.Writer) {
+	tw := tar.NewWriter(w)
+	for name, data := range members {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		io.WriteString(tw, data)
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	dir := t.TempDir()
+
+	writeZip(t, filepath.Join(dir, "backup.zip"))
+
+	f, _ := os.Create(filepath.Join(dir, "backup.tar"))
+	writeTar(t, f)
+	f.Close()
+
+	f, _ = os.Create(filepath.Join(dir, "backup.tgz"))
+	zw := gzip.NewWriter(f)
+	writeTar(t, zw)
+	zw.Close()
+	f.Close()
+
+	for _, name := range []string{"backup.zip", "backup.tar", "backup.tgz"} {
+		path := filepath.Join(dir, name)
+		var got []string
+
+		err := Walk(path, func(member string, f fs.File, info fs.FileInfo) error {
+			data, err := io.ReadAll(f)
+			if err != nil {
+				return err
+			}
+
+			_, inside, _ := Split(member)
+			if string(data) != members[inside] || info.Size() != int64(len(data)) {
+				t.Errorf("%s: got %q (%d bytes)", member, data, info.Size())
+			}
+
+			got = append(got, inside)
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		slices.Sort(got)
+		if !slices.Equal(got, []string{"c.txt", "docs/a.pdf", "docs/deep/b.txt"}) {
+			t.Errorf("%s: walked %v", name, got)
+		}
+
+		member := path + Sep + "docs/deep/b.txt"
+		if info, err := Stat(member); err != nil || info.Size() != 5 {
+			t.Errorf("%s: stat %v %v", name, info, err)
+		}
+
+		r, err := Open(member)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+
+		if string(data) != "notes" {
+			t.Errorf("%s: read %q", name, data)
+		}
+	}
+}
+
+func TestGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt.gz")
+
+	f, _ := os.Create(path)
+	zw := gzip.NewWriter(f)
+	io.WriteString(zw, "hello")
+	zw.Close()
+	f.Close()
+
+	r, err := Open(path + Sep + "notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if data, _ := io.ReadAll(r); string(data) != "hello" {
+		t.Errorf("read %q", data)
+	}
+
+	// a gzip bomb isn't unpacked all the way
+	defer func(n int64) { maxUnpacked = n }(maxUnpacked)
+	maxUnpacked = 4
+
+	if _, err := Open(path + Sep + "notes.txt"); err == nil {
+		t.Errorf("expected an error past the limit")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	dir := t.TempDir()
+	p := func(name string) string { return filepath.Join(dir, filepath.FromSlash(name)) }
+
+	// directories whose names only look like archives and members
+	for _, name := range []string{"photos!/a.txt", "old.zip!/b.txt", "old.zip/c.txt"} {
+		os.MkdirAll(filepath.Dir(p(name)), 0o755)
+		os.WriteFile(p(name), []byte("plain"), 0o644)
+	}
+	writeZip(t, p("photos!/backup.zip"))
+
+	for _, name := range []string{"photos!/a.txt", "old.zip!/b.txt"} {
+		if arch, member, ok := Split(p(name)); ok {
+			t.Errorf("%s: split into %s and %s", name, arch, member)
+		}
+
+		if info, err := Stat(p(name)); err != nil || info.Size() != 5 {
+			t.Errorf("%s: stat %v %v", name, info, err)
+		}
+	}
+
+	arch, member, ok := Split(p("photos!/backup.zip") + Sep + "docs/a.pdf")
+	if !ok || arch != p("photos!/backup.zip") || member != "docs/a.pdf" {
+		t.Errorf("expected the zip and its member, got %s and %s", arch, member)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "backup.zip")
+	writeZip(t, path)
+
+	var x Index
+	if err := x.Walk(path, func(string, fs.File, fs.FileInfo) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func() (n int) {
+		x.infos.Range(func(any, any) bool { n++; return true })
+		return n
+	}
+
+	if n := count(); n != 3 {
+		t.Fatalf("expected 3 members remembered, got %d", n)
+	}
+
+	// the members of whatever archives are under a directory go with it
+	x.Forget(dir)
+	if n := count(); n != 0 {
+		t.Errorf("expected them forgotten, got %d", n)
+	}
+}
@@ -0,0 +1,95 @@
+package archive
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// a gzip file that unpacks to more than this is refused, rather than
+// filling the disk with a few bytes of zeros; a var so tests can lower it
+var maxUnpacked int64 = 4 << 30
+
+// openGzip unpacks a gzip file into a temporary file, since members
+// can't be read at an offset in a compressed stream. A .tar.gz becomes
+// a tar; anything else is an archive holding the one file.
+func openGzip(path string, tarball bool) (*FS, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "dupes-*")
+	if err != nil {
+		return nil, err
+	}
+
+	done := func() error {
+		tmp.Close()
+		return os.Remove(tmp.Name())
+	}
+
+	size, err := io.Copy(tmp, io.LimitReader(zr, maxUnpacked+1))
+	if err != nil {
+		done()
+		return nil, err
+	}
+
+	if size > maxUnpacked {
+		done()
+		return nil, fmt.Errorf("%s unpacks to more than %d bytes", path, maxUnpacked)
+	}
+
+	if tarball {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			done()
+			return nil, err
+		}
+
+		tfs, err := newTarFS(tmp)
+		if err != nil {
+			done()
+			return nil, err
+		}
+		return &FS{tfs, done}, nil
+	}
+
+	name := zr.Name
+	if name == "" || !fs.ValidPath(name) || strings.Contains(name, "/") {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	mtime := zr.ModTime
+	if info, err := f.Stat(); err == nil && mtime.IsZero() {
+		mtime = info.ModTime()
+	}
+
+	x := newIndexFS(tmp)
+	x.add(name, fileInfo{name, size, mtime}, 0)
+
+	return &FS{x, done}, nil
+}
+
+type fileInfo struct {
+	name  string
+	size  int64
+	mtime time.Time
+}
+
+func (f fileInfo) Name() string       { return f.name }
+func (f fileInfo) Size() int64        { return f.size }
+func (f fileInfo) Mode() fs.FileMode  { return 0o444 }
+func (f fileInfo) ModTime() time.Time { return f.mtime }
+func (f fileInfo) IsDir() bool        { return false }
+func (f fileInfo) Sys() any           { return nil }
@@ -0,0 +1,142 @@
+package archive
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// indexFS is a read-only file system over one uncompressed file, in
+// which every member is a section at a known offset. We read a tar's
+// headers once to build it and never need to read it in order again.
+type indexFS struct {
+	r     io.ReaderAt
+	nodes map[string]*node
+}
+
+type node struct {
+	info     fs.FileInfo
+	off      int64
+	children []fs.DirEntry
+}
+
+func newIndexFS(r io.ReaderAt) *indexFS {
+	x := &indexFS{r: r, nodes: make(map[string]*node)}
+	x.nodes["."] = &node{info: dirInfo(".")}
+	return x
+}
+
+// add records a member, creating the directories above it that the
+// archive didn't list itself
+func (x *indexFS) add(name string, info fs.FileInfo, off int64) {
+	if n, ok := x.nodes[name]; ok {
+		n.info, n.off = info, off
+		return
+	}
+
+	parent := path.Dir(name)
+	if _, ok := x.nodes[parent]; !ok {
+		x.add(parent, dirInfo(path.Base(parent)), 0)
+	}
+
+	x.nodes[name] = &node{info: info, off: off}
+	p := x.nodes[parent]
+	p.children = append(p.children, fs.FileInfoToDirEntry(info))
+}
+
+func newTarFS(f *os.File) (*indexFS, error) {
+	x := newIndexFS(f)
+	tr := tar.NewReader(f)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return x, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			x.add(name, hdr.FileInfo(), 0)
+		case tar.TypeReg:
+			// tar only reads whole headers, so we're at the data now
+			off, err := f.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			x.add(name, hdr.FileInfo(), off)
+		}
+	}
+}
+
+func (x *indexFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	n, ok := x.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if n.info.IsDir() {
+		return &openDir{n: n}, nil
+	}
+
+	return &openFile{n, io.NewSectionReader(x.r, n.off, n.info.Size())}, nil
+}
+
+type openFile struct {
+	n *node
+	*io.SectionReader
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return f.n.info, nil }
+func (f *openFile) Close() error               { return nil }
+
+type openDir struct {
+	n   *node
+	pos int
+}
+
+func (d *openDir) Stat() (fs.FileInfo, error) { return d.n.info, nil }
+func (d *openDir) Close() error               { return nil }
+
+func (d *openDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.n.info.Name(), Err: fs.ErrInvalid}
+}
+
+func (d *openDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := d.n.children[d.pos:]
+
+	if count > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+		rest = rest[:min(count, len(rest))]
+	}
+
+	d.pos += len(rest)
+	return rest, nil
+}
+
+// dirInfo is a directory the archive implies but doesn't list
+type dirInfo string
+
+func (d dirInfo) Name() string       { return string(d) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o555 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() any           { return nil }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"27/manifest"
+)
+
+func main() {
+	format := flag.String("format", "text", "output format: text or json")
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		log.Fatal("Missing parameters, provide two or more manifests!")
+	}
+
+	var ms []*manifest.Manifest
+
+	for _, path := range flag.Args() {
+		m, err := manifest.Load(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ms = append(ms, m)
+	}
+
+	diff := manifest.Compare(ms...)
+
+	if err := diff.Write(os.Stdout, *format); err != nil {
+		log.Fatal(err)
+	}
+
+	// like diff, exit 1 if the trees aren't the same
+	if diff.Summary.Only > 0 || diff.Summary.Diverged > 0 {
+		os.Exit(1)
+	}
+}
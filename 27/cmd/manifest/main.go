@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"27/filter"
+	"27/manifest"
+	"27/progress"
+	"27/report"
+	"27/walk"
+)
+
+func main() {
+	out := flag.String("o", "", "write the manifest to this file instead of stdout")
+	show := flag.Bool("progress", progress.IsTerminal(os.Stderr), "show progress on stderr")
+	var opts filter.Options
+	opts.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatal("Missing parameter, provide directory name!")
+	}
+
+	root := flag.Arg(0)
+
+	filt, err := filter.New(root, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dst := os.Stdout
+	if *out != "" {
+		if dst, err = os.Create(*out); err != nil {
+			log.Fatal(err)
+		}
+		defer dst.Close()
+	}
+
+	abs, _ := filepath.Abs(root)
+	host, _ := os.Hostname()
+
+	mw, err := manifest.NewWriter(dst, manifest.Header{Host: host, Root: abs, Created: time.Now().UTC()})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Ctrl-C stops the walk, leaving a manifest of what we got to
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var errs report.Errors
+	prog := progress.New()
+	stop := func() {}
+
+	if *show {
+		stop = prog.Report(os.Stderr, 500*time.Millisecond)
+	}
+
+	w := walk.New(root, filt, &errs)
+
+	// unlike the finders we keep every file, not just the duplicates,
+	// since the other side may have a copy
+	w.Walk(ctx, ".", func(name string, info fs.FileInfo) {
+		prog.Found(info.Size())
+		sums, _, err := w.Sums(name, prog)
+		prog.Hashed()
+
+		if err != nil {
+			errs.Add(w.Path(name), report.Hash, err)
+		}
+
+		for _, s := range sums {
+			rel, _ := filepath.Rel(filepath.Clean(root), s.Path)
+			if err := mw.Add(manifest.Entry{Hash: s.Hash, Size: s.Size, Path: filepath.ToSlash(rel)}); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}, nil)
+
+	stop()
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "interrupted, the manifest is partial")
+	}
+
+	if errs.Len() > 0 {
+		errs.Write(os.Stderr)
+	}
+
+	if ctx.Err() != nil || errs.Len() > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,67 +1,118 @@
 package main
 
 import (
-	"crypto/md5"
+	"context"
+	"flag"
 	"fmt"
-	"io"
 	"io/fs"
 	"log"
 	"os"
-	"path/filepath"
-)
+	"os/signal"
+	"time"
 
-type pair struct {
-	hash string
-	path string
-}
+	"27/filter"
+	"27/progress"
+	"27/report"
+	"27/similar"
+	"27/tree"
+	"27/walk"
+)
 
 type fileList []string
 type result map[string]fileList
 
 func main() {
-	if len(os.Args) < 2 {
+	format := flag.String("format", report.Text, "output format: text, json, ndjson or csv")
+	order := flag.String("sort", report.ByWasted, "sort groups by wasted, count or path")
+	dirs := flag.Bool("dirs", false, "report duplicated directories and leave their files out of the groups")
+	show := flag.Bool("progress", progress.IsTerminal(os.Stderr), "show progress on stderr")
+	var opts filter.Options
+	opts.AddFlags(flag.CommandLine)
+	var near similar.Options
+	near.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		log.Fatal("Missing parameter, provide directory name!")
 	}
 
-	if hashes, err := searchTree(os.Args[1]); err != nil {
-		for hash, files := range hashes {
-			if len(files) > 1 {
-				// use 7 characters like git
-				fmt.Println(hash[len(hash)-7:], len(files))
-				for _, file := range files {
-					fmt.Println(" ", file)
-				}
-			}
-		}
+	if err := report.Check(*format, *order); err != nil {
+		log.Fatal(err)
 	}
-}
 
-func searchTree(dir string) (result, error) {
-	hashes := make(result)
-	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
-		// ignore error for now
-		if info.Mode().IsRegular() && info.Size() > 0 {
-			h := hashFile(path)
-			hashes[h.hash] = append(hashes[h.hash], h.path)
-		}
+	if err := near.Check(); err != nil {
+		log.Fatal(err)
+	}
 
-		return nil
-	})
+	filt, err := filter.New(flag.Arg(0), opts)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	return hashes, err
-}
+	// Ctrl-C stops the walk but lets us print what we have so far
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
 
-func hashFile(path string) pair {
-	file, err := os.Open(path)
-	if err != nil {
-		log.Fatalf("Error opening %s %s", path, err)
+	var errs report.Errors
+	prog := progress.New()
+	stop := func() {}
+
+	if *show {
+		stop = prog.Report(os.Stderr, 500*time.Millisecond)
 	}
-	defer file.Close()
 
-	hash := md5.New() // not secure but fast and good enough
-	if _, err := io.Copy(hash, file); err != nil {
-		log.Fatalf("Error copying %s %s", path, err)
+	w := walk.New(flag.Arg(0), filt, &errs)
+	hashes := searchTree(ctx, w, prog, &errs)
+	stop()
+
+	var groups []report.DirGroup
+	if *dirs {
+		groups = tree.Find(flag.Arg(0), hashes, w.Stat)
+		hashes = tree.Collapse(hashes, groups)
+	}
+
+	rep := report.New(hashes, *order, w.Stat)
+	rep.AddDirs(groups)
+
+	if near.Enabled() {
+		rep.AddSimilar(similar.Find(ctx, hashes, near, w.Stat, &errs))
 	}
 
-	return pair{fmt.Sprintf("%x", hash.Sum(nil)), path}
+	if err := rep.Write(os.Stdout, *format); err != nil {
+		log.Fatal(err)
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "interrupted, the results are partial")
+	}
+
+	if errs.Len() > 0 {
+		errs.Write(os.Stderr)
+	}
+
+	if ctx.Err() != nil || errs.Len() > 0 {
+		os.Exit(1)
+	}
+}
+
+func searchTree(ctx context.Context, w *walk.Walker,
+	prog *progress.Counter, errs *report.Errors) result {
+
+	hashes := make(result)
+
+	w.Walk(ctx, ".", func(name string, info fs.FileInfo) {
+		prog.Found(info.Size())
+		sums, _, err := w.Sums(name, prog)
+		prog.Hashed()
+
+		if err != nil {
+			errs.Add(w.Path(name), report.Hash, err)
+		}
+
+		for _, s := range sums {
+			hashes[s.Hash] = append(hashes[s.Hash], s.Path)
+		}
+	}, nil)
+
+	return hashes
 }
@@ -1,102 +1,163 @@
 package main
 
 import (
-	"crypto/md5"
+	"context"
+	"flag"
 	"fmt"
-	"io"
 	"io/fs"
 	"log"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"sync"
+	"time"
+
+	"27/filter"
+	"27/progress"
+	"27/report"
+	"27/similar"
+	"27/tree"
+	"27/walk"
 )
 
-type pair struct {
-	hash string
-	path string
-}
-
 type fileList []string
 type result map[string]fileList
 
 func main() {
-	if len(os.Args) < 2 {
+	format := flag.String("format", report.Text, "output format: text, json, ndjson or csv")
+	order := flag.String("sort", report.ByWasted, "sort groups by wasted, count or path")
+	dirs := flag.Bool("dirs", false, "report duplicated directories and leave their files out of the groups")
+	show := flag.Bool("progress", progress.IsTerminal(os.Stderr), "show progress on stderr")
+	var opts filter.Options
+	opts.AddFlags(flag.CommandLine)
+	var near similar.Options
+	near.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		log.Fatal("Missing parameter, provide directory name!")
 	}
-	paths := make(chan string)
-	var wg sync.WaitGroup
-	wg.Add(1)
-	err := walkDir(os.Args[1], paths, &wg)
 
+	if err := report.Check(*format, *order); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := near.Check(); err != nil {
+		log.Fatal(err)
+	}
+
+	filt, err := filter.New(flag.Arg(0), opts)
 	if err != nil {
-		log.Fatalf("Error walking directory %s %s", os.Args[1], err)
+		log.Fatal(err)
+	}
+
+	// Ctrl-C stops the walk but lets us print what we have so far
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var errs report.Errors
+	prog := progress.New()
+	stop := func() {}
+
+	if *show {
+		stop = prog.Report(os.Stderr, 500*time.Millisecond)
+	}
+
+	w := walk.New(flag.Arg(0), filt, &errs)
+	hashes := find(ctx, w, prog, &errs)
+	stop()
+
+	var groups []report.DirGroup
+	if *dirs {
+		groups = tree.Find(flag.Arg(0), hashes, w.Stat)
+		hashes = tree.Collapse(hashes, groups)
+	}
+
+	rep := report.New(hashes, *order, w.Stat)
+	rep.AddDirs(groups)
+
+	if near.Enabled() {
+		rep.AddSimilar(similar.Find(ctx, hashes, near, w.Stat, &errs))
+	}
+
+	if err := rep.Write(os.Stdout, *format); err != nil {
+		log.Fatal(err)
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "interrupted, the results are partial")
+	}
+
+	if errs.Len() > 0 {
+		errs.Write(os.Stderr)
 	}
 
+	if ctx.Err() != nil || errs.Len() > 0 {
+		os.Exit(1)
+	}
+}
+
+// find walks each directory in a goroutine of its own and hashes what
+// they turn up in one more, grouping the paths by hash; every goroutine
+// it starts is done by the time it returns, cancelled or not
+func find(ctx context.Context, w *walk.Walker, prog *progress.Counter, errs *report.Errors) result {
+	paths := make(chan string)
+
+	// start the collector first, otherwise the walk blocks on
+	// the first path it sends
 	var swg sync.WaitGroup
 	var hashes result
 	swg.Add(1)
 	go func() {
-		hashes = processFile(paths)
+		hashes = processFile(ctx, w, paths, prog, errs)
 		swg.Done()
 	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	walkDir(ctx, w, ".", paths, &wg, prog)
+
 	wg.Wait()
 	close(paths)
 	swg.Wait()
 
-	for hash, files := range hashes {
-		if len(files) > 1 {
-			// use 7 characters like git
-			fmt.Println(hash[len(hash)-7:], len(files))
-			for _, file := range files {
-				fmt.Println(" ", file)
-			}
-		}
-	}
+	return hashes
 }
 
-func walkDir(dir string, paths chan<- string, wg *sync.WaitGroup) error {
+func walkDir(ctx context.Context, w *walk.Walker, dir string, paths chan<- string,
+	wg *sync.WaitGroup, prog *progress.Counter) {
 	defer wg.Done()
 
-	return filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
-		// ignore the directory itself to avoid an infinite loop
-		if info.Mode().IsDir() && path != dir {
-			wg.Add(1)
-			go walkDir(path, paths, wg)
-			return filepath.SkipDir
-		}
-
-		if info.Mode().IsRegular() && info.Size() > 0 {
-			paths <- path
-		}
-
-		return nil
+	w.Walk(ctx, dir, func(name string, info fs.FileInfo) {
+		prog.Found(info.Size())
+		paths <- name
+	}, func(sub string) {
+		wg.Add(1)
+		go walkDir(ctx, w, sub, paths, wg, prog)
 	})
 }
 
-func processFile(paths <-chan string) result {
+func processFile(ctx context.Context, w *walk.Walker, paths <-chan string,
+	prog *progress.Counter, errs *report.Errors) result {
+
 	hashed := make(result)
 
-	for path := range paths {
-		p := hashFile(path)
-		hashed[p.hash] = append(hashed[p.hash], p.path)
-	}
+	for name := range paths {
+		// once cancelled, finish the hash we're on but drain the rest
+		if ctx.Err() != nil {
+			continue
+		}
 
-	return hashed
-}
+		sums, _, err := w.Sums(name, prog)
+		prog.Hashed()
 
-func hashFile(path string) pair {
-	file, err := os.Open(path)
-	if err != nil {
-		log.Printf("Skipping %s: %s", path, err)
-		return pair{"", ""}
-	}
-	defer file.Close()
+		if err != nil {
+			errs.Add(w.Path(name), report.Hash, err)
+		}
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		log.Printf("Error hashing %s: %s", path, err)
-		return pair{"", ""}
+		for _, s := range sums {
+			hashed[s.Hash] = append(hashed[s.Hash], s.Path)
+		}
 	}
 
-	return pair{fmt.Sprintf("%x", hash.Sum(nil)), path}
+	return hashed
 }
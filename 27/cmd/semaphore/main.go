@@ -1,117 +1,196 @@
 package main
 
 import (
-	"crypto/md5"
+	"context"
+	"flag"
 	"fmt"
-	"io"
 	"io/fs"
 	"log"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"sync"
+	"time"
+
+	"27/adaptive"
+	"27/filter"
+	"27/progress"
+	"27/report"
+	"27/similar"
+	"27/tree"
+	"27/walk"
 )
 
-type pair struct {
-	hash string
-	path string
-}
-
 type fileList []string
 type result map[string]fileList
 
-const workers = 32
+// directory walks share a fixed semaphore; file reads get
+// a limiter per device, which adapts unless -workers is set
+const walkers = 32
 
 func main() {
-	if len(os.Args) < 2 {
+	format := flag.String("format", report.Text, "output format: text, json, ndjson or csv")
+	order := flag.String("sort", report.ByWasted, "sort groups by wasted, count or path")
+	workers := flag.Int("workers", 0, "concurrent file reads per device, 0 adapts to the throughput")
+	dirs := flag.Bool("dirs", false, "report duplicated directories and leave their files out of the groups")
+	show := flag.Bool("progress", progress.IsTerminal(os.Stderr), "show progress on stderr")
+	var opts filter.Options
+	opts.AddFlags(flag.CommandLine)
+	var near similar.Options
+	near.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		log.Fatal("Missing parameter, provide directory name!")
 	}
-	var wg sync.WaitGroup
-	sem := make(chan any, workers)
-	pairs := make(chan pair, workers)
-	results := make(chan result)
 
-	go collect(pairs, results)
+	if err := report.Check(*format, *order); err != nil {
+		log.Fatal(err)
+	}
 
-	wg.Add(1)
-	err := walkDir(os.Args[1], pairs, &wg, sem)
+	if err := near.Check(); err != nil {
+		log.Fatal(err)
+	}
 
+	filt, err := filter.New(flag.Arg(0), opts)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Ctrl-C stops the walk but lets us print what we have so far
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var errs report.Errors
+	prog := progress.New()
+	stop := func() {}
+
+	if *show {
+		stop = prog.Report(os.Stderr, 500*time.Millisecond)
+	}
+
+	w := walk.New(flag.Arg(0), filt, &errs)
+	hashes := find(ctx, w, *workers, prog, &errs)
+	stop()
+
+	var groups []report.DirGroup
+	if *dirs {
+		groups = tree.Find(flag.Arg(0), hashes, w.Stat)
+		hashes = tree.Collapse(hashes, groups)
+	}
+
+	rep := report.New(hashes, *order, w.Stat)
+	rep.AddDirs(groups)
+
+	if near.Enabled() {
+		rep.AddSimilar(similar.Find(ctx, hashes, near, w.Stat, &errs))
+	}
+
+	if err := rep.Write(os.Stdout, *format); err != nil {
+		log.Fatal(err)
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "interrupted, the results are partial")
+	}
+
+	if errs.Len() > 0 {
+		errs.Write(os.Stderr)
+	}
+
+	if ctx.Err() != nil || errs.Len() > 0 {
+		os.Exit(1)
+	}
+}
+
+// find starts a goroutine for every directory and every file, with the
+// walks and reads held back by their semaphores, and groups the paths
+// by hash; every goroutine it starts is done by the time it returns,
+// cancelled or not
+func find(ctx context.Context, w *walk.Walker, workers int, prog *progress.Counter, errs *report.Errors) result {
+	var wg sync.WaitGroup
+	sem := make(chan any, walkers)
+	pairs := make(chan walk.Sum, walkers)
+	limits := adaptive.NewGroup(func() adaptive.Limiter {
+		if workers > 0 {
+			return adaptive.NewFixed(workers)
+		}
+		return adaptive.NewAIMD(adaptive.DefaultOptions)
+	})
+	results := make(chan result)
+
+	go collect(pairs, results)
+
+	wg.Add(1)
+	walkDir(ctx, w, ".", pairs, &wg, sem, limits, prog, errs)
+
 	wg.Wait()
 	close(pairs)
-	hashes := <-results
-
-	for hash, files := range hashes {
-		if len(files) > 1 {
-			// use 7 characters like git
-			fmt.Println(hash[len(hash)-7:], len(files))
-			for _, file := range files {
-				fmt.Println(" ", file)
-			}
-		}
-	}
-	close(results)
+
+	return <-results
 }
 
-func collect(pairs <-chan pair, results chan<- result) {
+func collect(pairs <-chan walk.Sum, results chan<- result) {
 	hashed := make(result)
 
 	for p := range pairs {
-		hashed[p.hash] = append(hashed[p.hash], p.path)
+		hashed[p.Hash] = append(hashed[p.Hash], p.Path)
 	}
 
 	results <- hashed
 }
 
-func walkDir(dir string, pairs chan<- pair, wg *sync.WaitGroup, sem chan any) error {
+func walkDir(ctx context.Context, w *walk.Walker, dir string, pairs chan<- walk.Sum, wg *sync.WaitGroup,
+	sem chan any, limits *adaptive.Group, prog *progress.Counter, errs *report.Errors) {
 	defer wg.Done()
-	sem <- nil
+
+	if !acquire(ctx, sem) {
+		return
+	}
 	defer func() {
 		<-sem
 	}()
 
-	return filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
-		// ignore the directory itself to avoid an infinite loop
-		if info.Mode().IsDir() && path != dir {
-			wg.Add(1)
-			go walkDir(path, pairs, wg, sem)
-			return filepath.SkipDir
-		}
-
-		if info.Mode().IsRegular() && info.Size() > 0 {
-			wg.Add(1)
-			go processFile(path, pairs, wg, sem)
-		}
-
-		return nil
+	w.Walk(ctx, dir, func(name string, info fs.FileInfo) {
+		prog.Found(info.Size())
+		lim := limits.For(filter.Device(info))
+		wg.Add(1)
+		go processFile(ctx, w, name, pairs, wg, lim, prog, errs)
+	}, func(sub string) {
+		wg.Add(1)
+		go walkDir(ctx, w, sub, pairs, wg, sem, limits, prog, errs)
 	})
 }
 
-func processFile(path string, pairs chan<- pair, wg *sync.WaitGroup, sem chan any) {
+func processFile(ctx context.Context, w *walk.Walker, name string, pairs chan<- walk.Sum, wg *sync.WaitGroup,
+	lim adaptive.Limiter, prog *progress.Counter, errs *report.Errors) {
 	defer wg.Done()
-	sem <- nil
-	defer func() {
-		<-sem
-	}()
 
-	pairs <- hashFile(path)
-}
+	// files still waiting for a slot are dropped once we're cancelled,
+	// but those already being hashed are allowed to finish
+	if lim.Acquire(ctx) != nil {
+		return
+	}
 
-func hashFile(path string) pair {
-	file, err := os.Open(path)
-	if err != nil {
-		log.Printf("Skipping %s: %s", path, err)
-		return pair{"", ""}
+	sums, n, err := w.Sums(name, prog)
+
+	lim.Release(n)
+	prog.Hashed()
+
+	for _, s := range sums {
+		pairs <- s
 	}
-	defer file.Close()
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		log.Printf("Error hashing %s: %s", path, err)
-		return pair{"", ""}
+	if err != nil {
+		errs.Add(w.Path(name), report.Hash, err)
 	}
+}
 
-	return pair{fmt.Sprintf("%x", hash.Sum(nil)), path}
+// acquire waits for a slot in the semaphore, giving up if ctx is done
+func acquire(ctx context.Context, sem chan any) bool {
+	select {
+	case sem <- nil:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
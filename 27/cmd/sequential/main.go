@@ -1,70 +1,143 @@
 package main
 
 import (
-	"crypto/md5"
+	"context"
+	"flag"
 	"fmt"
-	"io"
 	"io/fs"
 	"log"
 	"os"
-	"path/filepath"
-	"runtime"
+	"os/signal"
+	"time"
+
+	"27/adaptive"
+	"27/filter"
+	"27/progress"
+	"27/report"
+	"27/similar"
+	"27/tree"
+	"27/walk"
 )
 
-type pair struct {
-	hash string
-	path string
-}
-
 type fileList []string
 type result map[string]fileList
 
 func main() {
-	if len(os.Args) < 2 {
+	format := flag.String("format", report.Text, "output format: text, json, ndjson or csv")
+	order := flag.String("sort", report.ByWasted, "sort groups by wasted, count or path")
+	reads := flag.Int("workers", 0, "concurrent file reads, 0 adapts to the throughput")
+	dirs := flag.Bool("dirs", false, "report duplicated directories and leave their files out of the groups")
+	show := flag.Bool("progress", progress.IsTerminal(os.Stderr), "show progress on stderr")
+	var opts filter.Options
+	opts.AddFlags(flag.CommandLine)
+	var near similar.Options
+	near.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		log.Fatal("Missing parameter, provide directory name!")
 	}
-	workers := 2 * runtime.GOMAXPROCS(0)
+
+	if err := report.Check(*format, *order); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := near.Check(); err != nil {
+		log.Fatal(err)
+	}
+
+	filt, err := filter.New(flag.Arg(0), opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Ctrl-C stops the walk but lets us print what we have so far
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var errs report.Errors
+	prog := progress.New()
+	stop := func() {}
+
+	if *show {
+		stop = prog.Report(os.Stderr, 500*time.Millisecond)
+	}
+
+	// with a fixed limit we only need that many workers, otherwise
+	// start as many as the limit could ever grow to
+	var lim adaptive.Limiter
+	workers := *reads
+
+	if workers > 0 {
+		lim = adaptive.NewFixed(workers)
+	} else {
+		workers = adaptive.DefaultOptions.Max
+		lim = adaptive.NewAIMD(adaptive.DefaultOptions)
+	}
+
+	w := walk.New(flag.Arg(0), filt, &errs)
+	hashes := find(ctx, w, workers, lim, prog, &errs)
+	stop()
+
+	var groups []report.DirGroup
+	if *dirs {
+		groups = tree.Find(flag.Arg(0), hashes, w.Stat)
+		hashes = tree.Collapse(hashes, groups)
+	}
+
+	rep := report.New(hashes, *order, w.Stat)
+	rep.AddDirs(groups)
+
+	if near.Enabled() {
+		rep.AddSimilar(similar.Find(ctx, hashes, near, w.Stat, &errs))
+	}
+
+	if err := rep.Write(os.Stdout, *format); err != nil {
+		log.Fatal(err)
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "interrupted, the results are partial")
+	}
+
+	if errs.Len() > 0 {
+		errs.Write(os.Stderr)
+	}
+
+	if ctx.Err() != nil || errs.Len() > 0 {
+		os.Exit(1)
+	}
+}
+
+// find hashes everything the walk turns up with a pool of workers and
+// groups the paths by hash; every goroutine it starts is done by the
+// time it returns, cancelled or not
+func find(ctx context.Context, w *walk.Walker, workers int, lim adaptive.Limiter,
+	prog *progress.Counter, errs *report.Errors) result {
+
 	paths := make(chan string)
-	pairs := make(chan pair)
+	pairs := make(chan walk.Sum)
 	done := make(chan bool)
 	results := make(chan result)
 
 	for range workers {
-		go processFiles(paths, pairs, done)
+		go processFiles(ctx, w, paths, pairs, done, lim, prog, errs)
 	}
 
 	// we need another go routine so we don't block here
 	go collectHashes(pairs, results)
 
-	hashes := searchTree(os.Args[1], workers,
-		paths, pairs, results, done)
-
-	for hash, files := range hashes {
-		if len(files) > 1 {
-			// use 7 characters like git
-			fmt.Println(hash[len(hash)-7:], len(files))
-			for _, file := range files {
-				fmt.Println(" ", file)
-			}
-		}
-	}
+	return searchTree(ctx, w, workers, paths, pairs, results, done, prog)
 }
 
-func searchTree(dir string, workers int,
-	paths chan<- string, pairs chan<- pair,
-	results <-chan result, done <-chan bool) result {
-
-	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
-		if info.Mode().IsRegular() && info.Size() > 0 {
-			paths <- path
-		}
-
-		return nil
-	})
+func searchTree(ctx context.Context, w *walk.Walker, workers int,
+	paths chan<- string, pairs chan<- walk.Sum,
+	results <-chan result, done <-chan bool, prog *progress.Counter) result {
 
-	if err != nil {
-		log.Fatalf("Error walking %s %s", dir, err)
-	}
+	w.Walk(ctx, ".", func(name string, info fs.FileInfo) {
+		prog.Found(info.Size())
+		paths <- name
+	}, nil)
 
 	// close paths so that the workers stop
 	close(paths)
@@ -79,35 +152,38 @@ func searchTree(dir string, workers int,
 	return hashes
 }
 
-func collectHashes(pairs <-chan pair, results chan<- result) {
+func collectHashes(pairs <-chan walk.Sum, results chan<- result) {
 	hashes := make(result)
 
 	for p := range pairs {
-		hashes[p.hash] = append(hashes[p.hash], p.path)
+		hashes[p.Hash] = append(hashes[p.Hash], p.Path)
 	}
 
 	results <- hashes
 }
 
-func processFiles(paths <-chan string, pairs chan<- pair, done chan<- bool) {
-	for path := range paths {
-		pairs <- hashFile(path)
-	}
+func processFiles(ctx context.Context, w *walk.Walker, paths <-chan string, pairs chan<- walk.Sum,
+	done chan<- bool, lim adaptive.Limiter, prog *progress.Counter, errs *report.Errors) {
 
-	done <- true
-}
+	for name := range paths {
+		// once cancelled, finish the hash we're on but drain the rest
+		if lim.Acquire(ctx) != nil {
+			continue
+		}
 
-func hashFile(path string) pair {
-	file, err := os.Open(path)
-	if err != nil {
-		log.Fatalf("Error opening %s %s", path, err)
-	}
-	defer file.Close()
+		sums, n, err := w.Sums(name, prog)
+
+		lim.Release(n)
+		prog.Hashed()
+
+		for _, s := range sums {
+			pairs <- s
+		}
 
-	hash := md5.New() // not secure but fast and good enough
-	if _, err := io.Copy(hash, file); err != nil {
-		log.Fatalf("Error copying %s %s", path, err)
+		if err != nil {
+			errs.Add(w.Path(name), report.Hash, err)
+		}
 	}
 
-	return pair{fmt.Sprintf("%x", hash.Sum(nil)), path}
+	done <- true
 }
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"27/adaptive"
+	"27/internal/findtest"
+	"27/progress"
+	"27/report"
+	"27/walk"
+)
+
+func TestFind(t *testing.T) {
+	findtest.Run(t, func(ctx context.Context, w *walk.Walker, errs *report.Errors) result {
+		return find(ctx, w, 4, adaptive.NewFixed(2), progress.New(), errs)
+	})
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"27/archive"
+	"27/filter"
+	"27/index"
+	"27/report"
+	"27/walk"
+	"27/watch"
+)
+
+// event is printed as one JSON line whenever a file turns out to be a
+// duplicate of files we already have
+type event struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	Path  string    `json:"path"`
+	Hash  string    `json:"hash"`
+	Files []string  `json:"files"`
+}
+
+type finder struct {
+	root string
+	filt *filter.Filter
+	walk *walk.Walker // hashes like the other finders do, archives and all
+	idx  *index.Index
+	w    *watch.Watcher
+	errs *report.Errors
+	out  *json.Encoder
+	live bool // false while building the index, so we don't report what was already there
+
+	// the paths hashed during a rescan, nil otherwise
+	seen map[string]bool
+}
+
+func main() {
+	addr := flag.String("http", "localhost:8080", "serve the current groups on this address")
+	format := flag.String("format", report.JSON, "default format for /groups: text, json, ndjson or csv")
+	order := flag.String("sort", report.ByWasted, "default order for /groups: wasted, count or path")
+	var opts filter.Options
+	opts.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatal("Missing parameter, provide directory name!")
+	}
+
+	if err := report.Check(*format, *order); err != nil {
+		log.Fatal(err)
+	}
+
+	// a link's target can change without us hearing about it
+	if opts.FollowLinks {
+		log.Fatal("-follow isn't supported in watch mode")
+	}
+
+	filt, err := filter.New(flag.Arg(0), opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w, err := watch.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var errs report.Errors
+	root := filepath.Clean(flag.Arg(0))
+
+	f := &finder{
+		root: root,
+		filt: filt,
+		walk: walk.New(root, filt, &errs),
+		idx:  index.New(),
+		w:    w,
+		errs: &errs,
+		out:  json.NewEncoder(os.Stdout),
+	}
+
+	// watch before walking, so nothing written during the walk is lost
+	if err := w.Add(root); err != nil {
+		log.Fatal(err)
+	}
+
+	start := time.Now()
+	f.scan(ctx, ".")
+	f.live = true
+	log.Printf("indexed %d files in %s, watching for changes", f.idx.Len(), time.Since(start).Round(time.Millisecond))
+	f.flushErrors()
+
+	http.HandleFunc("/groups", func(rw http.ResponseWriter, r *http.Request) {
+		fm, ord := *format, *order
+		if v := r.URL.Query().Get("format"); v != "" {
+			fm = v
+		}
+		if v := r.URL.Query().Get("sort"); v != "" {
+			ord = v
+		}
+
+		if err := report.Check(fm, ord); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if fm == report.JSON {
+			rw.Header().Set("Content-Type", "application/json")
+		}
+
+		report.New(f.idx.Snapshot(), ord, f.walk.Stat).Write(rw, fm)
+	})
+
+	srv := &http.Server{Addr: *addr}
+	go func() {
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			srv.Shutdown(context.Background())
+			return
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			f.handle(ctx, ev)
+			f.flushErrors()
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.Print(err)
+
+			// the index can't be trusted anymore
+			if errors.Is(err, watch.ErrOverflow) {
+				f.rescan(ctx)
+				f.flushErrors()
+			}
+		}
+	}
+}
+
+func (f *finder) handle(ctx context.Context, ev watch.Event) {
+	if ev.Op == watch.Remove {
+		// a directory moved out of the tree would still send us
+		// events, for paths that aren't there anymore
+		if ev.Dir {
+			if err := f.w.Remove(ev.Path); err != nil {
+				f.errs.Add(ev.Path, report.Walk, err)
+			}
+		}
+		f.forget(ev.Path)
+		return
+	}
+
+	info, err := os.Lstat(ev.Path)
+	if err != nil {
+		// gone again already
+		f.forget(ev.Path)
+		return
+	}
+
+	act, _, err := f.filt.Check(ev.Path, info)
+	if err != nil {
+		f.errs.Add(ev.Path, report.Link, err)
+		return
+	}
+
+	name, err := filepath.Rel(f.root, ev.Path)
+	if err != nil {
+		f.errs.Add(ev.Path, report.Walk, err)
+		return
+	}
+	name = filepath.ToSlash(name)
+
+	switch act {
+	case filter.Descend:
+		// files may have landed before the watch was in place
+		f.watchDir(ctx, name)
+	case filter.Hash:
+		f.hash(name)
+	default:
+		// the file may have been replaced by something we skip
+		f.forget(ev.Path)
+	}
+}
+
+// scan walks a directory, given by its name in the walk, hashing its
+// files and watching its subdirectories
+func (f *finder) scan(ctx context.Context, dir string) {
+	f.walk.Walk(ctx, dir, func(name string, _ fs.FileInfo) {
+		f.hash(name)
+	}, func(sub string) {
+		f.watchDir(ctx, sub)
+	})
+}
+
+func (f *finder) watchDir(ctx context.Context, dir string) {
+	if err := f.w.Add(f.walk.Path(dir)); err != nil {
+		f.errs.Add(f.walk.Path(dir), report.Walk, err)
+		return
+	}
+
+	f.scan(ctx, dir)
+}
+
+// hash indexes a file and, if it's an archive to unpack, its members,
+// reporting any that turn out to be duplicates
+func (f *finder) hash(name string) {
+	path := f.walk.Path(name)
+
+	// the members it had may be gone now; looking for them means
+	// going through the whole index, so only archives do
+	if f.walk.Unpacks(name) {
+		f.idx.RemovePrefix(path + archive.Sep)
+		f.walk.Forget(path)
+	}
+
+	sums, _, err := f.walk.Sums(name, nil)
+	if err != nil {
+		f.errs.Add(path, report.Hash, err)
+	}
+
+	indexed := false
+	for _, s := range sums {
+		indexed = indexed || s.Path == path
+		if f.seen != nil {
+			f.seen[s.Path] = true
+		}
+
+		if files := f.idx.Put(s.Path, s.Hash); files != nil && f.live {
+			f.out.Encode(event{time.Now(), "duplicate", s.Path, s.Hash, files})
+		}
+	}
+
+	// it couldn't be read, or it's an archive -include leaves out
+	if !indexed {
+		f.idx.Remove(path)
+	}
+}
+
+// forget drops a file, or everything under a directory, from the index
+func (f *finder) forget(path string) {
+	f.idx.Remove(path)
+	f.idx.RemoveDir(path)
+
+	if f.filt.Unpacks(path) {
+		f.idx.RemovePrefix(path + archive.Sep)
+	}
+	f.walk.Forget(path)
+}
+
+// rescan walks the whole tree again once the watcher has missed
+// changes. What hasn't changed stays as it was, so only new duplicates
+// are reported, and whatever isn't found again is forgotten; the
+// watches are all set up again too, as some may be on directories
+// that have since moved out of the tree.
+func (f *finder) rescan(ctx context.Context) {
+	start := time.Now()
+
+	if err := f.w.Remove(f.root); err != nil {
+		f.errs.Add(f.root, report.Walk, err)
+	}
+	if err := f.w.Add(f.root); err != nil {
+		f.errs.Add(f.root, report.Walk, err)
+		return
+	}
+
+	f.seen = make(map[string]bool)
+	f.scan(ctx, ".")
+	seen := f.seen
+	f.seen = nil
+
+	// a scan cut short hasn't seen everything
+	if ctx.Err() != nil {
+		return
+	}
+
+	f.idx.RemoveFunc(func(path string) bool { return !seen[path] })
+	log.Printf("rescanned %d files in %s", f.idx.Len(), time.Since(start).Round(time.Millisecond))
+}
+
+// flushErrors prints what went wrong since the last call; in a
+// long-running finder errors are reported as they happen
+func (f *finder) flushErrors() {
+	if f.errs.Len() > 0 {
+		f.errs.Write(os.Stderr)
+		f.errs.Reset()
+	}
+}
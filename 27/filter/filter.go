@@ -0,0 +1,308 @@
+// Package filter decides which paths a duplicate scan looks at, so that
+// every walking strategy honors the same options.
+package filter
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"27/archive"
+)
+
+type Options struct {
+	Include     []string // if set, only files matching one of these are hashed
+	Exclude     []string // files and directories to skip
+	MinSize     int64
+	MaxSize     int64 // 0 means no limit
+	FollowLinks bool
+	OneFS       bool // don't cross into other filesystems
+	Archives    bool // also hash the files inside zip and tar archives
+}
+
+// Action tells a walk callback what to do with a path
+type Action int
+
+const (
+	Skip    Action = iota // ignore this entry
+	Prune                 // a directory not to descend into
+	Descend               // a directory to walk
+	Follow                // a symlink to a directory, to be walked on its own
+	Hash                  // a file to hash
+)
+
+type Filter struct {
+	opts    Options
+	root    string
+	stat    func(path string) (fs.FileInfo, error) // follows links
+	include []pattern
+	exclude []pattern
+	dev     uint64
+
+	// directories and files we've reached, so that following
+	// links can't loop or hash the same file twice
+	mu   sync.Mutex
+	seen map[fileID]bool
+}
+
+// New makes a filter for a scan starting at root
+func New(root string, opts Options) (*Filter, error) {
+	if opts.FollowLinks && !haveIDs {
+		return nil, errors.New("following links isn't supported on this platform")
+	}
+
+	return newFilter(filepath.Clean(root), os.Stat, opts)
+}
+
+// ForFS makes a filter for a scan of a whole fs.FS, whose paths are
+// the slash-separated names in it
+func ForFS(fsys fs.FS, opts Options) (*Filter, error) {
+	return newFilter(".", func(name string) (fs.FileInfo, error) {
+		return fs.Stat(fsys, name)
+	}, opts)
+}
+
+func newFilter(root string, stat func(string) (fs.FileInfo, error), opts Options) (*Filter, error) {
+	info, err := stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Filter{
+		opts: opts,
+		root: root,
+		stat: stat,
+		seen: make(map[fileID]bool),
+	}
+
+	for _, s := range opts.Include {
+		f.include = append(f.include, parsePattern(s))
+	}
+
+	for _, s := range opts.Exclude {
+		f.exclude = append(f.exclude, parsePattern(s))
+	}
+
+	if id, ok := idOf(info); ok {
+		f.dev = id.dev
+		f.seen[id] = true
+	}
+
+	return f, nil
+}
+
+// Check looks at a path found by a walk, given its Lstat info, and
+// returns what to do with it, along with the info of the link target
+// if it's a symlink; the error is set for broken symlinks.
+//
+// The root of every walk has already been checked (the top one by New,
+// the others by the callback that started them), so walkers shouldn't
+// pass it in again.
+func (f *Filter) Check(path string, info fs.FileInfo) (Action, fs.FileInfo, error) {
+	return f.CheckEntry(path, fs.FileInfoToDirEntry(info))
+}
+
+// CheckEntry is Check for a walk that gives us directory entries. It
+// only stats the entry when a rule needs the size or identity, so the
+// returned info is nil for directories unless links are followed or
+// filesystems are compared.
+func (f *Filter) CheckEntry(path string, d fs.DirEntry) (Action, fs.FileInfo, error) {
+	var info fs.FileInfo
+	link := d.Type()&fs.ModeSymlink != 0
+
+	if link {
+		target, err := f.stat(path)
+		if err != nil {
+			return Skip, nil, err
+		}
+
+		if !f.opts.FollowLinks {
+			return Skip, nil, nil
+		}
+
+		info = target
+		d = fs.FileInfoToDirEntry(target)
+	}
+
+	if d.IsDir() {
+		if f.excluded(path, true) {
+			return f.pruned(link)
+		}
+
+		if f.opts.OneFS || f.opts.FollowLinks {
+			if info == nil {
+				var err error
+				if info, err = d.Info(); err != nil {
+					return Skip, nil, err
+				}
+			}
+
+			if !f.sameFS(info) || !f.first(info) {
+				return f.pruned(link)
+			}
+		}
+
+		if link {
+			return Follow, info, nil
+		}
+		return Descend, info, nil
+	}
+
+	if !d.Type().IsRegular() {
+		return Skip, info, nil
+	}
+
+	// an archive is hashed whatever -include says, in case its
+	// members match; Reports tells whether it counts itself
+	if f.excluded(path, false) || !f.included(path) && !f.Unpacks(path) {
+		return Skip, info, nil
+	}
+
+	if info == nil {
+		var err error
+		if info, err = d.Info(); err != nil {
+			return Skip, nil, err
+		}
+	}
+
+	if !f.sized(info.Size()) {
+		return Skip, info, nil
+	}
+
+	// only links can lead us to a file twice
+	if f.opts.FollowLinks && !f.first(info) {
+		return Skip, info, nil
+	}
+
+	return Hash, info, nil
+}
+
+// pruned skips a directory; a link to one is simply not followed
+func (f *Filter) pruned(link bool) (Action, fs.FileInfo, error) {
+	if link {
+		return Skip, nil, nil
+	}
+	return Prune, nil, nil
+}
+
+// Unpacks reports whether the members of the file at path should be
+// hashed too
+func (f *Filter) Unpacks(path string) bool {
+	return f.opts.Archives && archive.Is(path)
+}
+
+// Reports says whether a file to hash belongs among the results itself,
+// as an archive that -include leaves out is only hashed for its members
+func (f *Filter) Reports(path string) bool {
+	return f.included(path)
+}
+
+// Member checks a file inside an archive, with the same rules as the
+// files outside
+func (f *Filter) Member(path string, info fs.FileInfo) bool {
+	return info.Mode().IsRegular() && f.sized(info.Size()) &&
+		!f.excluded(path, false) && f.included(path)
+}
+
+// Device names the filesystem a file lives on, so that work can be
+// limited per device; it's empty if the platform doesn't tell us
+func Device(info fs.FileInfo) string {
+	if id, ok := idOf(info); ok {
+		return strconv.FormatUint(id.dev, 10)
+	}
+
+	return ""
+}
+
+func (f *Filter) rel(path string) string {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (f *Filter) excluded(path string, isDir bool) bool {
+	rel := f.rel(path)
+
+	for _, p := range f.exclude {
+		if p.match(rel, isDir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *Filter) included(path string) bool {
+	if len(f.include) == 0 {
+		return true
+	}
+
+	rel := f.rel(path)
+
+	for _, p := range f.include {
+		if p.match(rel, false) {
+			return true
+		}
+	}
+
+	// a pattern naming a directory takes in everything under it, the
+	// way -exclude leaves it all out
+	for dir := rel; strings.Contains(dir, "/"); {
+		dir = dir[:strings.LastIndex(dir, "/")]
+
+		for _, p := range f.include {
+			if p.match(dir, true) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (f *Filter) sized(size int64) bool {
+	// empty files are all the same, they're never interesting
+	if size == 0 || size < f.opts.MinSize {
+		return false
+	}
+
+	return f.opts.MaxSize == 0 || size <= f.opts.MaxSize
+}
+
+func (f *Filter) sameFS(info fs.FileInfo) bool {
+	if !f.opts.OneFS {
+		return true
+	}
+
+	id, ok := idOf(info)
+	return !ok || id.dev == f.dev
+}
+
+// first reports whether this is the first time we've reached the file
+// or directory; without links every entry is reached once anyway
+func (f *Filter) first(info fs.FileInfo) bool {
+	if !f.opts.FollowLinks {
+		return true
+	}
+
+	id, ok := idOf(info)
+	if !ok {
+		return true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.seen[id] {
+		return false
+	}
+
+	f.seen[id] = true
+	return true
+}
@@ -0,0 +1,125 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPatternMatch(t *testing.T) {
+	table := []struct {
+		pattern string
+		rel     string
+		isDir   bool
+		want    bool
+	}{
+		{"node_modules", "web/node_modules", true, true},
+		{"node_modules/", "web/node_modules", false, false},
+		{"*.tmp", "a/b/c.tmp", false, true},
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"docs/*.pdf", "docs/a.pdf", false, true},
+		{"docs/*.pdf", "docs/x/a.pdf", false, false},
+		{"docs/**/*.pdf", "docs/x/y/a.pdf", false, true},
+		{"docs/**/*.pdf", "docs/a.pdf", false, true},
+		{"**/cache", "home/me/.cache", true, false},
+		{"**/cache", "home/me/cache", true, true},
+	}
+
+	for _, st := range table {
+		if got := parsePattern(st.pattern).match(st.rel, st.isDir); got != st.want {
+			t.Errorf("%q ~ %q: expected %t, got %t", st.pattern, st.rel, st.want, got)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	root := t.TempDir()
+	write := func(name string, size int) string {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+
+		if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	small := write("small.txt", 10)
+	big := write("big.bin", 1000)
+	empty := write("empty", 0)
+	git := filepath.Dir(write(".git/HEAD", 10))
+	loop := filepath.Join(root, "loop")
+	broken := filepath.Join(root, "broken")
+	os.Symlink(root, loop)
+	os.Symlink(filepath.Join(root, "nowhere"), broken)
+
+	f, err := New(root, Options{
+		Include:     []string{"*.txt", "*.bin"},
+		Exclude:     []string{".git/"},
+		MaxSize:     100,
+		FollowLinks: true,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		path string
+		want Action
+	}{
+		{small, Hash},
+		{big, Skip},
+		{empty, Skip},
+		{git, Prune},
+		{loop, Skip},
+	}
+
+	for _, st := range table {
+		info, _ := os.Lstat(st.path)
+
+		if got, _, err := f.Check(st.path, info); err != nil || got != st.want {
+			t.Errorf("%s: expected %d, got %d (%v)", st.path, st.want, got, err)
+		}
+	}
+
+	info, _ := os.Lstat(broken)
+	if _, _, err := f.Check(broken, info); err == nil {
+		t.Errorf("expected an error for a broken link")
+	}
+}
+
+func TestIncludeDir(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"src/a.go", "src/deep/b.go", "vendor/c.go", "docs/d.md", "srcs/e.go"} {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		os.WriteFile(path, []byte("data"), 0o644)
+	}
+
+	f, err := New(root, Options{Include: []string{"src/", "vendor"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		name string
+		want Action
+	}{
+		{"src/a.go", Hash},
+		{"src/deep/b.go", Hash},
+		{"vendor/c.go", Hash},
+		{"docs/d.md", Skip},
+		{"srcs/e.go", Skip},
+	}
+
+	for _, st := range table {
+		path := filepath.Join(root, st.name)
+		info, _ := os.Lstat(path)
+
+		if got, _, err := f.Check(path, info); err != nil || got != st.want {
+			t.Errorf("%s: expected %d, got %d (%v)", st.name, st.want, got, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package filter
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AddFlags registers the options as command-line flags
+func (o *Options) AddFlags(set *flag.FlagSet) {
+	set.Var((*list)(&o.Include), "include", "only hash files matching this glob (repeatable)")
+	set.Var((*list)(&o.Exclude), "exclude", "skip files and directories matching this glob (repeatable)")
+	set.Var((*size)(&o.MinSize), "min-size", "skip files smaller than this, e.g. 4K")
+	set.Var((*size)(&o.MaxSize), "max-size", "skip files larger than this, e.g. 2G")
+	set.BoolVar(&o.FollowLinks, "follow", false, "follow symbolic links")
+	set.BoolVar(&o.OneFS, "one-fs", false, "don't cross into other filesystems")
+	set.BoolVar(&o.Archives, "archives", false, "also hash the files inside zip, tar and gzip archives")
+}
+
+// list is a flag that can be given more than once
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// size is a byte count with an optional K, M or G suffix
+type size int64
+
+func (s *size) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *size) Set(v string) error {
+	if v == "" {
+		return fmt.Errorf("empty size")
+	}
+
+	mult := int64(1)
+
+	switch strings.ToUpper(v[len(v)-1:]) {
+	case "K":
+		mult = 1 << 10
+	case "M":
+		mult = 1 << 20
+	case "G":
+		mult = 1 << 30
+	}
+
+	if mult > 1 {
+		v = v[:len(v)-1]
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("bad size %q", v)
+	}
+
+	*s = size(n * mult)
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package filter
+
+import "io/fs"
+
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// without device and inode numbers we can't detect link cycles
+// or mount points, so links aren't followed and every entry looks local
+const haveIDs = false
+
+func idOf(info fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package filter
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+const haveIDs = true
+
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+func idOf(info fs.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+
+	return fileID{uint64(st.Dev), uint64(st.Ino)}, true
+}
@@ -0,0 +1,79 @@
+package filter
+
+import (
+	"path"
+	"strings"
+)
+
+// pattern is one gitignore-style glob:
+//
+//	node_modules   a name matched at any depth
+//	build/         only matches directories
+//	/vendor        anchored to the root of the scan
+//	docs/**/*.tmp  ** matches any number of directories
+type pattern struct {
+	parts    []string
+	anchored bool
+	dirOnly  bool
+}
+
+func parsePattern(s string) pattern {
+	var p pattern
+
+	if strings.HasSuffix(s, "/") {
+		p.dirOnly = true
+		s = strings.TrimRight(s, "/")
+	}
+
+	// like git, a slash anywhere but the end anchors the pattern
+	if strings.Contains(s, "/") {
+		p.anchored = true
+		s = strings.TrimPrefix(s, "/")
+	}
+
+	p.parts = strings.Split(s, "/")
+	return p
+}
+
+// match reports whether rel, a slash-separated path relative to
+// the root of the scan, matches the pattern
+func (p pattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	parts := strings.Split(rel, "/")
+
+	if !p.anchored {
+		ok, _ := path.Match(p.parts[0], parts[len(parts)-1])
+		return ok
+	}
+
+	return matchParts(p.parts, parts)
+}
+
+func matchParts(pat, parts []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			// try to match the rest after skipping 0..n directories
+			for i := 0; i <= len(parts); i++ {
+				if matchParts(pat[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pat[0], parts[0]); !ok {
+			return false
+		}
+
+		pat, parts = pat[1:], parts[1:]
+	}
+
+	return len(parts) == 0
+}
@@ -0,0 +1,113 @@
+// Package index keeps a hash table of files that can be updated one
+// file at a time, for finders that run for a long time.
+package index
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type Index struct {
+	mu     sync.RWMutex
+	byPath map[string]string // path -> hash
+	byHash map[string][]string
+}
+
+func New() *Index {
+	return &Index{
+		byPath: make(map[string]string),
+		byHash: make(map[string][]string),
+	}
+}
+
+// Put records the hash of path, replacing what we had for it. If that
+// makes path a duplicate of other files, it returns the whole group.
+func (x *Index) Put(path, hash string) []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if old, ok := x.byPath[path]; ok {
+		if old == hash {
+			return nil
+		}
+		x.remove(path)
+	}
+
+	x.byPath[path] = hash
+	x.byHash[hash] = append(x.byHash[hash], path)
+
+	if group := x.byHash[hash]; len(group) > 1 {
+		return slices.Clone(group)
+	}
+
+	return nil
+}
+
+func (x *Index) Remove(path string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(path)
+}
+
+// RemoveDir forgets every file under dir
+func (x *Index) RemoveDir(dir string) {
+	x.RemovePrefix(filepath.Clean(dir) + string(filepath.Separator))
+}
+
+// RemovePrefix forgets every path that starts with prefix, such as the
+// members of an archive
+func (x *Index) RemovePrefix(prefix string) {
+	x.RemoveFunc(func(path string) bool { return strings.HasPrefix(path, prefix) })
+}
+
+// RemoveFunc forgets every path del returns true for; it looks at all
+// of them, so it's for whole directories rather than single files
+func (x *Index) RemoveFunc(del func(path string) bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for path := range x.byPath {
+		if del(path) {
+			x.remove(path)
+		}
+	}
+}
+
+// remove is called with the lock held
+func (x *Index) remove(path string) {
+	hash, ok := x.byPath[path]
+	if !ok {
+		return
+	}
+
+	delete(x.byPath, path)
+
+	group := slices.DeleteFunc(x.byHash[hash], func(p string) bool { return p == path })
+	if len(group) == 0 {
+		delete(x.byHash, hash)
+	} else {
+		x.byHash[hash] = group
+	}
+}
+
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.byPath)
+}
+
+// Snapshot returns a copy of the hash table, which the caller can
+// use while the index carries on changing
+func (x *Index) Snapshot() map[string][]string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	out := make(map[string][]string, len(x.byHash))
+	for hash, paths := range x.byHash {
+		out[hash] = slices.Clone(paths)
+	}
+
+	return out
+}
@@ -0,0 +1,68 @@
+package index
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPut(t *testing.T) {
+	x := New()
+
+	if got := x.Put("/a/1", "h1"); got != nil {
+		t.Errorf("first file shouldn't be a duplicate, got %v", got)
+	}
+
+	got := x.Put("/b/1", "h1")
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"/a/1", "/b/1"}) {
+		t.Errorf("expected both files, got %v", got)
+	}
+
+	// same content again isn't news
+	if got := x.Put("/b/1", "h1"); got != nil {
+		t.Errorf("unchanged file reported again: %v", got)
+	}
+
+	// a modified file leaves its old group
+	x.Put("/b/1", "h2")
+	snap := x.Snapshot()
+	if len(snap["h1"]) != 1 || len(snap["h2"]) != 1 {
+		t.Errorf("modified file still grouped: %v", snap)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	x := New()
+	x.Put("/a/1", "h1")
+	x.Put("/a/sub/2", "h1")
+	x.Put("/ab/3", "h1")
+	x.Put("/c/4", "h2")
+
+	x.RemoveDir("/a")
+
+	snap := x.Snapshot()
+	if !slices.Equal(snap["h1"], []string{"/ab/3"}) {
+		t.Errorf("expected only /ab/3 left, got %v", snap["h1"])
+	}
+
+	x.Remove("/c/4")
+	if _, ok := x.Snapshot()["h2"]; ok || x.Len() != 1 {
+		t.Errorf("empty group kept: %v", x.Snapshot())
+	}
+
+	// an archive's members go without the archive
+	x.Put("/d.zip", "h3")
+	x.Put("/d.zip!/5", "h1")
+	x.Put("/d.zip!/sub/6", "h1")
+	x.RemovePrefix("/d.zip!/")
+
+	if snap := x.Snapshot(); !slices.Equal(snap["h1"], []string{"/ab/3"}) || x.Len() != 2 {
+		t.Errorf("expected the members gone and the archive kept, got %v", snap)
+	}
+
+	// a rescan drops whatever it didn't see
+	x.RemoveFunc(func(path string) bool { return path != "/d.zip" })
+	if snap := x.Snapshot(); len(snap) != 1 || !slices.Equal(snap["h3"], []string{"/d.zip"}) {
+		t.Errorf("expected only /d.zip left, got %v", snap)
+	}
+}
@@ -0,0 +1,69 @@
+// Package findtest runs the same checks against every duplicate
+// finder, so that they're held to one fixture and one leak check.
+package findtest
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"27/filter"
+	"27/report"
+	"27/walk"
+	"leaktest"
+)
+
+func file(s string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(s), Mode: 0o644}
+}
+
+// Run hashes a small tree with find, then again with a cancelled
+// context, and fails t if the duplicates are wrong, it doesn't stop
+// early, or it leaves any goroutine running
+func Run[M ~map[string]L, L ~[]string](t *testing.T, find func(ctx context.Context, w *walk.Walker, errs *report.Errors) M) {
+	t.Helper()
+	leaktest.Check(t)
+
+	fsys := fstest.MapFS{
+		"a.txt":           file("same"),
+		"b.txt":           file("different"),
+		"sub/a.txt":       file("same"),
+		"sub/deeper/a.md": file("same"),
+		"other/c.txt":     file("different again"),
+	}
+
+	run := func(ctx context.Context) (M, *report.Errors) {
+		filt, err := filter.ForFS(fsys, filter.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errs := &report.Errors{}
+		return find(ctx, walk.NewFS(fsys, filt, errs), errs), errs
+	}
+
+	hashes, errs := run(context.Background())
+	if errs.Len() > 0 || len(hashes) != 3 {
+		t.Fatalf("expected 3 hashes, got %v %v", hashes, errs.List())
+	}
+
+	var dups []string
+	for _, paths := range hashes {
+		if len(paths) > 1 {
+			dups = slices.Sorted(slices.Values(paths))
+		}
+	}
+
+	if !slices.Equal(dups, []string{"a.txt", "sub/a.txt", "sub/deeper/a.md"}) {
+		t.Errorf("unexpected duplicates %v", dups)
+	}
+
+	// cancelled, it stops early and still lets everything go
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if hashes, _ := run(ctx); len(hashes) != 0 {
+		t.Errorf("expected nothing hashed, got %v", hashes)
+	}
+}
@@ -0,0 +1,171 @@
+package manifest
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Location is a file in one of the manifests compared
+type Location struct {
+	Manifest string `json:"manifest"`
+	Path     string `json:"path"`
+	Hash     string `json:"hash"`
+	Size     int64  `json:"size"`
+}
+
+// Shared is content found in more than one manifest, at any path
+type Shared struct {
+	Hash  string     `json:"hash"`
+	Size  int64      `json:"size"`
+	Files []Location `json:"files"`
+}
+
+// Diverged is a path found in more than one manifest with different
+// content
+type Diverged struct {
+	Path     string     `json:"path"`
+	Versions []Location `json:"versions"`
+}
+
+type Summary struct {
+	Shared      int   `json:"shared"`
+	SharedBytes int64 `json:"shared_bytes"` // counted once per content
+	Only        int   `json:"only"`
+	OnlyBytes   int64 `json:"only_bytes"`
+	Diverged    int   `json:"diverged"`
+}
+
+type Diff struct {
+	Shared   []Shared   `json:"shared"`
+	Only     []Location `json:"only"`
+	Diverged []Diverged `json:"diverged"`
+	Summary  Summary    `json:"summary"`
+}
+
+// Compare works out what content the manifests have in common, what
+// only one of them has, and which paths they all have but with
+// different content. A changed file is reported as diverged rather
+// than as two files that are each only in one place.
+func Compare(ms ...*Manifest) *Diff {
+	byHash := make(map[string][]Location)
+	byPath := make(map[string][]Location)
+
+	for _, m := range ms {
+		for _, e := range m.Files {
+			loc := Location{m.Name, e.Path, e.Hash, e.Size}
+			byHash[e.Hash] = append(byHash[e.Hash], loc)
+			byPath[e.Path] = append(byPath[e.Path], loc)
+		}
+	}
+
+	var d Diff
+	diverged := make(map[Location]bool)
+
+	for path, locs := range byPath {
+		if manifests(locs) < 2 || hashes(locs) < 2 {
+			continue
+		}
+
+		for _, l := range locs {
+			diverged[l] = true
+		}
+
+		slices.SortFunc(locs, byLocation)
+		d.Diverged = append(d.Diverged, Diverged{path, locs})
+	}
+
+	for hash, locs := range byHash {
+		slices.SortFunc(locs, byLocation)
+
+		if manifests(locs) > 1 {
+			d.Shared = append(d.Shared, Shared{hash, locs[0].Size, locs})
+			d.Summary.SharedBytes += locs[0].Size
+			continue
+		}
+
+		for _, l := range locs {
+			if !diverged[l] {
+				d.Only = append(d.Only, l)
+				d.Summary.OnlyBytes += l.Size
+			}
+		}
+	}
+
+	slices.SortFunc(d.Shared, func(a, b Shared) int { return byLocation(a.Files[0], b.Files[0]) })
+	slices.SortFunc(d.Only, byLocation)
+	slices.SortFunc(d.Diverged, func(a, b Diverged) int { return strings.Compare(a.Path, b.Path) })
+
+	d.Summary.Shared = len(d.Shared)
+	d.Summary.Only = len(d.Only)
+	d.Summary.Diverged = len(d.Diverged)
+
+	return &d
+}
+
+func byLocation(a, b Location) int {
+	return cmp.Or(strings.Compare(a.Manifest, b.Manifest), strings.Compare(a.Path, b.Path))
+}
+
+func manifests(locs []Location) int {
+	seen := make(map[string]bool)
+	for _, l := range locs {
+		seen[l.Manifest] = true
+	}
+	return len(seen)
+}
+
+func hashes(locs []Location) int {
+	seen := make(map[string]bool)
+	for _, l := range locs {
+		seen[l.Hash] = true
+	}
+	return len(seen)
+}
+
+// Write outputs the comparison as text, one line per item so that it
+// can be grepped, or as JSON
+func (d *Diff) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case "text":
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	for _, s := range d.Shared {
+		fmt.Fprint(w, "same ", short(s.Hash))
+		for _, l := range s.Files {
+			fmt.Fprintf(w, " %s:%s", l.Manifest, l.Path)
+		}
+		fmt.Fprintln(w)
+	}
+
+	for _, l := range d.Only {
+		fmt.Fprintf(w, "only %s:%s\n", l.Manifest, l.Path)
+	}
+
+	for _, v := range d.Diverged {
+		fmt.Fprint(w, "diff ", v.Path)
+		for _, l := range v.Versions {
+			fmt.Fprintf(w, " %s:%s", l.Manifest, short(l.Hash))
+		}
+		fmt.Fprintln(w)
+	}
+
+	s := d.Summary
+	_, err := fmt.Fprintf(w, "%d shared (%d bytes), %d only in one (%d bytes), %d diverged\n",
+		s.Shared, s.SharedBytes, s.Only, s.OnlyBytes, s.Diverged)
+	return err
+}
+
+// use 7 characters like git, and like the duplicate reports
+func short(hash string) string {
+	return hash[max(0, len(hash)-7):]
+}
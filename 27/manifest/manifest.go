@@ -0,0 +1,101 @@
+// Package manifest records the hash, size and relative path of every
+// file in a tree, so that trees on different machines can be compared
+// without copying any data between them.
+package manifest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// A manifest is written as JSON lines: a header, then one file per line
+// in the order they were hashed, so it can be streamed either way.
+type Header struct {
+	Host    string    `json:"host"`
+	Root    string    `json:"root"`
+	Created time.Time `json:"created"`
+}
+
+type Entry struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+	Path string `json:"path"` // slash-separated, relative to the root
+}
+
+type Manifest struct {
+	Header
+	Name  string // what to call it in a comparison, usually its file name
+	Files []Entry
+}
+
+// Writer writes a manifest one entry at a time
+type Writer struct {
+	enc *json.Encoder
+}
+
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(h); err != nil {
+		return nil, err
+	}
+
+	return &Writer{enc}, nil
+}
+
+func (w *Writer) Add(e Entry) error {
+	return w.enc.Encode(e)
+}
+
+func Read(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("empty manifest")
+	}
+
+	if err := json.Unmarshal(sc.Bytes(), &m.Header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+
+	for line := 2; sc.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if e.Hash == "" || e.Path == "" {
+			return nil, fmt.Errorf("line %d: missing hash or path", line)
+		}
+
+		m.Files = append(m.Files, e)
+	}
+
+	return &m, sc.Err()
+}
+
+// Load reads the manifest in a file, named after the file
+func Load(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	m.Name = path
+	return m, nil
+}
@@ -0,0 +1,70 @@
+package manifest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func build(name string, files ...string) *Manifest {
+	m := &Manifest{Name: name}
+
+	// "path hash"
+	for _, f := range files {
+		path, hash, _ := strings.Cut(f, " ")
+		m.Files = append(m.Files, Entry{Hash: hash, Size: int64(len(hash)), Path: path})
+	}
+
+	return m
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, Header{Host: "laptop", Root: "/home/me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Add(Entry{"abc", 3, "docs/a b.pdf"})
+	w.Add(Entry{"def", 5, "c"})
+
+	m, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Host != "laptop" || len(m.Files) != 2 || m.Files[0].Path != "docs/a b.pdf" {
+		t.Errorf("got %+v", m)
+	}
+
+	if _, err := Read(strings.NewReader("{}\n{\"size\":1}\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	a := build("a", "docs/x.pdf h1", "report.txt h2", "new.txt h3", "same.txt h5")
+	b := build("b", "old/x.pdf h1", "report.txt h4", "mine h6", "same.txt h5")
+	c := build("c", "x.pdf h1")
+
+	d := Compare(a, b, c)
+
+	if len(d.Shared) != 2 || len(d.Shared[0].Files) != 3 || d.Shared[0].Hash != "h1" {
+		t.Errorf("shared: %+v", d.Shared)
+	}
+
+	if len(d.Only) != 2 || d.Only[0].Path != "new.txt" || d.Only[1].Path != "mine" {
+		t.Errorf("only: %+v", d.Only)
+	}
+
+	if len(d.Diverged) != 1 || d.Diverged[0].Path != "report.txt" || len(d.Diverged[0].Versions) != 2 {
+		t.Errorf("diverged: %+v", d.Diverged)
+	}
+
+	var buf bytes.Buffer
+	d.Write(&buf, "text")
+
+	if !strings.Contains(buf.String(), "diff report.txt a:h2 b:h4\n") {
+		t.Errorf("text output:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,124 @@
+// Package progress counts the work done by a duplicate scan and prints
+// a status line while it runs.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is safe to update from any number of goroutines; each update
+// is a single atomic add, so the workers never wait on each other
+type Counter struct {
+	start      time.Time
+	found      atomic.Int64
+	foundBytes atomic.Int64
+	hashed     atomic.Int64
+	read       atomic.Int64
+}
+
+func New() *Counter {
+	return &Counter{start: time.Now()}
+}
+
+// Found records a file the walk will hash
+func (c *Counter) Found(size int64) {
+	c.found.Add(1)
+	c.foundBytes.Add(size)
+}
+
+// Hashed records a file that's been hashed (or failed to)
+func (c *Counter) Hashed() {
+	c.hashed.Add(1)
+}
+
+// Reader wraps r so that the bytes read through it are counted
+func (c *Counter) Reader(r io.Reader) io.Reader {
+	return &reader{r, c}
+}
+
+type reader struct {
+	r io.Reader
+	c *Counter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.c.read.Add(int64(n))
+	return n, err
+}
+
+func (c *Counter) String() string {
+	elapsed := time.Since(c.start)
+	found, hashed := c.found.Load(), c.hashed.Load()
+	read, total := c.read.Load(), c.foundBytes.Load()
+	rate := float64(read) / elapsed.Seconds()
+
+	// the ETA only covers what's been found so far, so it'll
+	// grow while the walk is still going
+	eta := "?"
+	if rate > 0 {
+		left := time.Duration(float64(total-read) / rate * float64(time.Second))
+		eta = left.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("found %d, hashed %d, read %s, %s/s, eta %s",
+		found, hashed, bytes(read), bytes(int64(rate)), eta)
+}
+
+// Report rewrites the status line on w every so often until the
+// returned stop function is called, which prints the final line
+func (c *Counter) Report(w io.Writer, every time.Duration) (stop func()) {
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	ticker := time.NewTicker(every)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// pad so a shorter line covers the last one
+				fmt.Fprintf(w, "\r%-80s", c)
+			case <-done:
+				fmt.Fprintf(w, "\r%-80s\n", c)
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func bytes(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// IsTerminal reports whether f looks like a terminal, where it's
+// worth drawing a status line
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
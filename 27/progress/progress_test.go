@@ -0,0 +1,48 @@
+package progress
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	c := New()
+	var wg sync.WaitGroup
+
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Found(1000)
+			io.Copy(io.Discard, c.Reader(strings.NewReader(strings.Repeat("x", 1000))))
+			c.Hashed()
+		}()
+	}
+	wg.Wait()
+
+	if c.found.Load() != 8 || c.hashed.Load() != 8 || c.read.Load() != 8000 {
+		t.Errorf("bad counts: %s", c)
+	}
+
+	if s := c.String(); !strings.HasPrefix(s, "found 8, hashed 8, read 7.8 KiB") {
+		t.Errorf("bad status: %s", s)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	table := map[int64]string{
+		0:       "0 B",
+		1023:    "1023 B",
+		1024:    "1.0 KiB",
+		1 << 20: "1.0 MiB",
+		3 << 29: "1.5 GiB",
+	}
+
+	for n, want := range table {
+		if got := bytes(n); got != want {
+			t.Errorf("%d: expected %s, got %s", n, want, got)
+		}
+	}
+}
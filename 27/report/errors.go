@@ -0,0 +1,123 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// operations that can fail during a scan
+const (
+	Walk = "walk"
+	Link = "link"
+	Hash = "hash"
+)
+
+// Problem is a path that couldn't be scanned
+type Problem struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+	Kind string `json:"kind"`
+	Err  string `json:"error"`
+}
+
+// Errors collects problems from any number of goroutines so that a scan
+// can carry on and report them all at the end
+type Errors struct {
+	mu   sync.Mutex
+	list []Problem
+}
+
+func (e *Errors) Add(path, op string, err error) {
+	msg := err.Error()
+
+	// the path is already in the problem, don't repeat it
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		msg = pe.Err.Error()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.list = append(e.list, Problem{path, op, kind(op, err), msg})
+}
+
+func (e *Errors) Len() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.list)
+}
+
+// Reset forgets the problems so far, for a finder that reports them as
+// they happen
+func (e *Errors) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.list = nil
+}
+
+// List returns the problems sorted by path
+func (e *Errors) List() []Problem {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	list := slices.Clone(e.list)
+	slices.SortFunc(list, func(a, b Problem) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Op, b.Op)
+	})
+
+	return list
+}
+
+// Write prints a count per kind followed by one line per problem
+func (e *Errors) Write(w io.Writer) error {
+	list := e.List()
+	if len(list) == 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, p := range list {
+		counts[p.Kind]++
+	}
+
+	kinds := make([]string, 0, len(counts))
+	for k := range counts {
+		kinds = append(kinds, k)
+	}
+	slices.Sort(kinds)
+
+	fmt.Fprintf(w, "%d errors:", len(list))
+	for _, k := range kinds {
+		fmt.Fprintf(w, " %s=%d", k, counts[k])
+	}
+	fmt.Fprintln(w)
+
+	for _, p := range list {
+		if _, err := fmt.Fprintf(w, "  %-14s %-4s %s: %s\n", p.Kind, p.Op, p.Path, p.Err); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func kind(op string, err error) string {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return "permission"
+	case op == Link:
+		return "broken-symlink"
+	case errors.Is(err, fs.ErrNotExist):
+		return "vanished"
+	}
+
+	return "other"
+}
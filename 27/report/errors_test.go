@@ -0,0 +1,60 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestErrorsKinds(t *testing.T) {
+	var errs Errors
+	var wg sync.WaitGroup
+
+	table := []struct {
+		path string
+		op   string
+		err  error
+		kind string
+	}{
+		{"/c", Hash, &fs.PathError{Op: "open", Path: "/c", Err: fs.ErrPermission}, "permission"},
+		{"/a", Link, &fs.PathError{Op: "stat", Path: "/a", Err: fs.ErrNotExist}, "broken-symlink"},
+		{"/b", Hash, &fs.PathError{Op: "open", Path: "/b", Err: fs.ErrNotExist}, "vanished"},
+		{"/d", Walk, errors.New("boom"), "other"},
+	}
+
+	for _, st := range table {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs.Add(st.path, st.op, st.err)
+		}()
+	}
+	wg.Wait()
+
+	if errs.Len() != len(table) {
+		t.Fatalf("expected %d problems, got %d", len(table), errs.Len())
+	}
+
+	list := errs.List()
+	for i, p := range list {
+		if i > 0 && list[i-1].Path > p.Path {
+			t.Errorf("not sorted: %v", list)
+		}
+
+		for _, st := range table {
+			if st.path == p.Path && st.kind != p.Kind {
+				t.Errorf("%s: expected %s, got %s", p.Path, st.kind, p.Kind)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	errs.Write(&buf)
+
+	if !strings.HasPrefix(buf.String(), "4 errors:") || strings.Contains(buf.String(), "open /b") {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+}
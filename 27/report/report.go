@@ -0,0 +1,386 @@
+// Package report turns the hash table built by the duplicate finders into
+// sorted groups and writes them as text, JSON, NDJSON or CSV.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// output formats
+const (
+	Text   = "text"
+	JSON   = "json"
+	NDJSON = "ndjson"
+	CSV    = "csv"
+)
+
+// sort orders
+const (
+	ByWasted = "wasted"
+	ByCount  = "count"
+	ByPath   = "path"
+)
+
+// StatFunc looks up a file to report, which may be an archive member;
+// archive.Stat will do, or the Stat of the walk that found it, which
+// remembers the members
+type StatFunc func(path string) (fs.FileInfo, error)
+
+type File struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// Group is a set of files that share the same content hash
+type Group struct {
+	Hash   string `json:"hash"`
+	Size   int64  `json:"size"`
+	Count  int    `json:"count"`
+	Wasted int64  `json:"wasted"`
+	Files  []File `json:"files"`
+}
+
+// DirGroup is a set of directories with the same files in them; the
+// Size of each directory is the total size of its files
+type DirGroup struct {
+	Hash   string `json:"hash"`
+	Files  int    `json:"files"` // in each directory
+	Count  int    `json:"count"`
+	Wasted int64  `json:"wasted"`
+	Dirs   []File `json:"dirs"`
+}
+
+// Cluster is a set of files that are similar but not identical
+type Cluster struct {
+	Kind       string  `json:"kind"`
+	Method     string  `json:"method"`
+	Similarity float64 `json:"similarity"` // the least similar linked pair
+	Files      []File  `json:"files"`
+}
+
+type Summary struct {
+	Groups  int   `json:"groups"`
+	Files   int   `json:"files"`
+	Bytes   int64 `json:"bytes"`
+	Wasted  int64 `json:"wasted"`
+	Similar int   `json:"similar,omitempty"`
+	Dirs    int   `json:"dirs,omitempty"`
+}
+
+type Report struct {
+	Dirs    []DirGroup `json:"dirs,omitempty"`
+	Groups  []Group    `json:"groups"`
+	Similar []Cluster  `json:"similar,omitempty"`
+	Summary Summary    `json:"summary"`
+}
+
+// Check returns an error if format or order isn't supported
+func Check(format, order string) error {
+	switch format {
+	case Text, JSON, NDJSON, CSV:
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	switch order {
+	case ByWasted, ByCount, ByPath:
+	default:
+		return fmt.Errorf("unknown sort order %q", order)
+	}
+
+	return nil
+}
+
+// New builds a report from a hash -> paths table, keeping only the
+// hashes with more than one file; files that can't be stat'ed any more
+// are left out of their group
+func New[M ~map[string]L, L ~[]string](hashes M, order string, stat StatFunc) *Report {
+	r := &Report{}
+
+	for hash, paths := range hashes {
+		if len(paths) < 2 {
+			continue
+		}
+
+		r.add(Group{Hash: hash, Files: Stat(paths, stat)})
+	}
+
+	r.sort(order)
+	return r
+}
+
+// Stat looks up the size and mtime of the paths, leaving out any that
+// can't be stat'ed any more, and sorts them by path
+func Stat[L ~[]string](paths L, stat StatFunc) []File {
+	var files []File
+
+	for _, path := range paths {
+		info, err := stat(path)
+		if err != nil {
+			continue
+		}
+
+		files = append(files, File{path, info.Size(), info.ModTime()})
+	}
+
+	slices.SortFunc(files, func(a, b File) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return files
+}
+
+// AddDirs adds groups of duplicated directories, most wasted space
+// first; their files should already have been left out of the groups
+func (r *Report) AddDirs(groups []DirGroup) {
+	for _, g := range groups {
+		if len(g.Dirs) < 2 {
+			continue
+		}
+
+		g.Count = len(g.Dirs)
+		g.Wasted = g.Dirs[0].Size * int64(g.Count-1)
+
+		r.Dirs = append(r.Dirs, g)
+		r.Summary.Dirs++
+		r.Summary.Wasted += g.Wasted
+	}
+
+	slices.SortFunc(r.Dirs, func(a, b DirGroup) int {
+		if c := compare(b.Wasted, a.Wasted); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Hash, b.Hash)
+	})
+}
+
+// AddSimilar adds clusters of near-duplicates, largest first
+func (r *Report) AddSimilar(clusters []Cluster) {
+	for _, c := range clusters {
+		if len(c.Files) > 1 {
+			r.Similar = append(r.Similar, c)
+		}
+	}
+
+	slices.SortFunc(r.Similar, func(a, b Cluster) int {
+		if c := len(b.Files) - len(a.Files); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Files[0].Path, b.Files[0].Path)
+	})
+
+	r.Summary.Similar = len(r.Similar)
+}
+
+// add fills in the derived fields of g and appends it, unless it
+// no longer has any duplicates
+func (r *Report) add(g Group) {
+	if len(g.Files) < 2 {
+		return
+	}
+
+	g.Size = g.Files[0].Size
+	g.Count = len(g.Files)
+	g.Wasted = g.Size * int64(g.Count-1)
+
+	r.Groups = append(r.Groups, g)
+	r.Summary.Groups++
+	r.Summary.Files += g.Count
+	r.Summary.Bytes += g.Size * int64(g.Count)
+	r.Summary.Wasted += g.Wasted
+}
+
+// sort orders the groups; ties are always broken by hash so the
+// output is the same from one run to the next
+func (r *Report) sort(order string) {
+	slices.SortFunc(r.Groups, func(a, b Group) int {
+		var c int
+
+		switch order {
+		case ByCount:
+			c = b.Count - a.Count
+		case ByPath:
+			c = strings.Compare(a.Files[0].Path, b.Files[0].Path)
+		default:
+			c = compare(b.Wasted, a.Wasted)
+		}
+
+		if c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Hash, b.Hash)
+	})
+}
+
+func compare(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// Write outputs the report in the given format
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case Text:
+		return r.writeText(w)
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case NDJSON:
+		return r.writeNDJSON(w)
+	case CSV:
+		return r.writeCSV(w)
+	}
+
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func (r *Report) writeText(w io.Writer) error {
+	for _, g := range r.Dirs {
+		fmt.Fprintln(w, "dir", g.Hash[len(g.Hash)-7:], g.Count, g.Files, "files")
+
+		for _, d := range g.Dirs {
+			fmt.Fprintln(w, " ", d.Path+string(filepath.Separator))
+		}
+	}
+
+	for _, g := range r.Groups {
+		// use 7 characters like git
+		fmt.Fprintln(w, g.Hash[len(g.Hash)-7:], g.Count)
+
+		for _, f := range g.Files {
+			fmt.Fprintln(w, " ", f.Path)
+		}
+	}
+
+	for _, c := range r.Similar {
+		fmt.Fprintf(w, "~%s %s %d %.2f\n", c.Kind, c.Method, len(c.Files), c.Similarity)
+
+		for _, f := range c.Files {
+			fmt.Fprintln(w, " ", f.Path)
+		}
+	}
+
+	s := r.Summary
+	fmt.Fprintf(w, "%d groups, %d files, %d bytes wasted", s.Groups, s.Files, s.Wasted)
+
+	if s.Dirs > 0 {
+		fmt.Fprintf(w, ", %d directories", s.Dirs)
+	}
+
+	if s.Similar > 0 {
+		fmt.Fprintf(w, ", %d similar", s.Similar)
+	}
+
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// writeNDJSON writes one group per line followed by a summary line
+func (r *Report) writeNDJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	for _, g := range r.Dirs {
+		if err := enc.Encode(struct {
+			Dir DirGroup `json:"dir"`
+		}{g}); err != nil {
+			return err
+		}
+	}
+
+	for _, g := range r.Groups {
+		if err := enc.Encode(g); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range r.Similar {
+		if err := enc.Encode(struct {
+			Similar Cluster `json:"similar"`
+		}{c}); err != nil {
+			return err
+		}
+	}
+
+	return enc.Encode(struct {
+		Summary Summary `json:"summary"`
+	}{r.Summary})
+}
+
+// writeCSV writes one row per file, after one row per duplicated
+// directory with its total size; the files in a cluster of near
+// duplicates get a made-up "hash" like ~image-1 and no wasted count.
+// The summary goes last as a '#' comment line, which csv.Reader can
+// skip by setting Comment
+func (r *Report) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"hash", "size", "count", "wasted", "path", "mtime"})
+
+	for _, g := range r.Dirs {
+		for _, d := range g.Dirs {
+			cw.Write([]string{
+				g.Hash,
+				strconv.FormatInt(d.Size, 10),
+				strconv.Itoa(g.Count),
+				strconv.FormatInt(g.Wasted, 10),
+				d.Path + string(filepath.Separator),
+				d.ModTime.UTC().Format(time.RFC3339),
+			})
+		}
+	}
+
+	for _, g := range r.Groups {
+		for _, f := range g.Files {
+			cw.Write([]string{
+				g.Hash,
+				strconv.FormatInt(g.Size, 10),
+				strconv.Itoa(g.Count),
+				strconv.FormatInt(g.Wasted, 10),
+				f.Path,
+				f.ModTime.UTC().Format(time.RFC3339),
+			})
+		}
+	}
+
+	for i, c := range r.Similar {
+		id := fmt.Sprintf("~%s-%d", c.Kind, i+1)
+
+		for _, f := range c.Files {
+			cw.Write([]string{
+				id,
+				strconv.FormatInt(f.Size, 10),
+				strconv.Itoa(len(c.Files)),
+				"",
+				f.Path,
+				f.ModTime.UTC().Format(time.RFC3339),
+			})
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	s := r.Summary
+	_, err := fmt.Fprintf(w, "# dirs=%d groups=%d files=%d bytes=%d wasted=%d similar=%d\n",
+		s.Dirs, s.Groups, s.Files, s.Bytes, s.Wasted, s.Similar)
+	return err
+}
@@ -0,0 +1,122 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestNewSorts(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a1": "aaaa", "a2": "aaaa",
+		"b1": "b", "b2": "b", "b3": "b",
+		"c1": "c",
+	})
+	p := func(name string) string { return filepath.Join(dir, name) }
+	hashes := map[string][]string{
+		"aaaaaaaaaa": {p("a2"), p("a1")},
+		"bbbbbbbbbb": {p("b3"), p("b1"), p("b2")},
+		"cccccccccc": {p("c1")},
+	}
+
+	table := []struct {
+		order string
+		first string
+	}{
+		{ByWasted, "aaaaaaaaaa"},
+		{ByCount, "bbbbbbbbbb"},
+		{ByPath, "aaaaaaaaaa"},
+	}
+
+	for _, st := range table {
+		r := New(hashes, st.order, os.Stat)
+
+		if len(r.Groups) != 2 {
+			t.Fatalf("%s: expected 2 groups, got %d", st.order, len(r.Groups))
+		}
+
+		if r.Groups[0].Hash != st.first {
+			t.Errorf("%s: expected %s first, got %s", st.order, st.first, r.Groups[0].Hash)
+		}
+	}
+
+	r := New(hashes, ByWasted, os.Stat)
+	want := Summary{Groups: 2, Files: 5, Bytes: 11, Wasted: 6}
+
+	if r.Summary != want {
+		t.Errorf("summary: expected %+v, got %+v", want, r.Summary)
+	}
+
+	if r.Groups[0].Files[0].Path != p("a1") {
+		t.Errorf("files not sorted: %v", r.Groups[0].Files)
+	}
+}
+
+func TestWriteFormats(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"x": "same", "y": "same"})
+	hashes := map[string][]string{
+		"0123456789abcdef": {filepath.Join(dir, "x"), filepath.Join(dir, "y")},
+	}
+	r := New(hashes, ByWasted, os.Stat)
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf, JSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("bad json: %s", err)
+	}
+
+	if got.Summary.Wasted != 4 || got.Groups[0].Hash != "0123456789abcdef" {
+		t.Errorf("json round trip: %+v", got)
+	}
+
+	buf.Reset()
+	if err := r.Write(&buf, NDJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 {
+		t.Errorf("ndjson: expected 2 lines, got %d", len(lines))
+	}
+
+	buf.Reset()
+	if err := r.Write(&buf, CSV); err != nil {
+		t.Fatal(err)
+	}
+
+	cr := csv.NewReader(&buf)
+	cr.Comment = '#'
+	rows, err := cr.ReadAll()
+
+	if err != nil {
+		t.Fatalf("bad csv: %s", err)
+	}
+
+	if len(rows) != 3 || rows[1][3] != "4" {
+		t.Errorf("csv: %v", rows)
+	}
+
+	if err := r.Write(&buf, "xml"); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
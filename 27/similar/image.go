@@ -0,0 +1,88 @@
+package similar
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// gray shrinks img to w x h by averaging the luminance of the pixels
+// that fall in each cell, so the result doesn't depend on the size or
+// the encoding of the original
+func gray(img image.Image, w, h int) []float64 {
+	b := img.Bounds()
+	sums := make([]float64, w*h)
+	counts := make([]float64, w*h)
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		cy := (y - b.Min.Y) * h / b.Dy()
+
+		for x := b.Min.X; x < b.Max.X; x++ {
+			cx := (x - b.Min.X) * w / b.Dx()
+			r, g, bl, _ := img.At(x, y).RGBA()
+
+			sums[cy*w+cx] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+			counts[cy*w+cx]++
+		}
+	}
+
+	for i := range sums {
+		if counts[i] > 0 {
+			sums[i] /= counts[i]
+		}
+	}
+
+	return sums
+}
+
+// aHash sets a bit for each of 8x8 cells brighter than the average
+func aHash(img image.Image) uint64 {
+	cells := gray(img, 8, 8)
+
+	var mean float64
+	for _, c := range cells {
+		mean += c
+	}
+	mean /= float64(len(cells))
+
+	var h uint64
+	for i, c := range cells {
+		if c > mean {
+			h |= 1 << i
+		}
+	}
+
+	return h
+}
+
+// dHash sets a bit for each cell brighter than its right neighbour in
+// a 9x8 grid, which follows gradients rather than absolute brightness
+func dHash(img image.Image) uint64 {
+	cells := gray(img, 9, 8)
+
+	var h uint64
+	for y := range 8 {
+		for x := range 8 {
+			if cells[y*9+x] > cells[y*9+x+1] {
+				h |= 1 << (y*8 + x)
+			}
+		}
+	}
+
+	return h
+}
+
+func imageHash(r io.Reader, method string) (uint64, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return 0, err
+	}
+
+	if method == AHash {
+		return aHash(img), nil
+	}
+
+	return dHash(img), nil
+}
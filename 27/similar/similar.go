@@ -0,0 +1,373 @@
+// Package similar finds files that are nearly but not exactly the same:
+// resized or re-encoded images, and text that's had a few edits.
+package similar
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"27/archive"
+	"27/report"
+)
+
+// modes
+const (
+	Images = "images"
+	Text   = "text"
+)
+
+// fingerprints
+const (
+	AHash   = "ahash"
+	DHash   = "dhash"
+	MinHash = "minhash"
+	SimHash = "simhash"
+)
+
+// we only look at the start of very large text files
+const maxText = 8 << 20
+
+var imageExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+}
+
+var textExts = map[string]bool{
+	".txt": true, ".md": true, ".rst": true, ".tex": true, ".html": true,
+	".htm": true, ".xml": true, ".csv": true, ".json": true, ".log": true,
+}
+
+type Options struct {
+	Modes     []string
+	Threshold float64 // from 0 (anything) to 1 (identical fingerprints)
+	ImageHash string
+	TextHash  string
+}
+
+func (o *Options) AddFlags(set *flag.FlagSet) {
+	set.Func("similar", "also find near-duplicate images or text (repeatable)", func(s string) error {
+		if s != Images && s != Text {
+			return fmt.Errorf("want %s or %s", Images, Text)
+		}
+		o.Modes = append(o.Modes, s)
+		return nil
+	})
+	set.Float64Var(&o.Threshold, "threshold", 0.9, "how similar near-duplicates must be, from 0 to 1")
+	set.StringVar(&o.ImageHash, "image-hash", DHash, "perceptual hash for images: ahash or dhash")
+	set.StringVar(&o.TextHash, "text-hash", MinHash, "fingerprint for text: minhash or simhash")
+}
+
+// Check returns an error if the options don't make sense
+func (o *Options) Check() error {
+	if o.Threshold < 0 || o.Threshold > 1 {
+		return fmt.Errorf("threshold %g isn't between 0 and 1", o.Threshold)
+	}
+
+	if o.ImageHash != AHash && o.ImageHash != DHash {
+		return fmt.Errorf("unknown image hash %q", o.ImageHash)
+	}
+
+	if o.TextHash != MinHash && o.TextHash != SimHash {
+		return fmt.Errorf("unknown text hash %q", o.TextHash)
+	}
+
+	return nil
+}
+
+func (o *Options) Enabled() bool {
+	return len(o.Modes) > 0
+}
+
+// item is one exact group, fingerprinted through its first file
+type item struct {
+	kind  string
+	paths []string
+	path  string   // the copy we read, a loose file if the group has one
+	hash  uint64   // ahash, dhash or simhash
+	sig   []uint64 // minhash
+}
+
+// batch is what one worker reads in a go: the items inside one archive,
+// which is opened once for all of them, or a single file on disk
+type batch struct {
+	archive string
+	items   []*item
+}
+
+// Find fingerprints one file from each exact group (its copies would
+// give the same answer) and clusters the groups that are at least
+// Threshold similar to each other
+func Find[M ~map[string]L, L ~[]string](ctx context.Context, hashes M, opts Options,
+	stat report.StatFunc, errs *report.Errors) []report.Cluster {
+
+	var items []*item
+
+	for _, paths := range hashes {
+		ext := strings.ToLower(filepath.Ext(paths[0]))
+
+		switch {
+		case imageExts[ext] && slices.Contains(opts.Modes, Images):
+			items = append(items, &item{kind: Images, paths: paths})
+		case textExts[ext] && slices.Contains(opts.Modes, Text):
+			items = append(items, &item{kind: Text, paths: paths})
+		}
+	}
+
+	items = fingerprint(ctx, items, opts, errs)
+
+	var clusters []report.Cluster
+	clusters = append(clusters, cluster(items, Images, opts.ImageHash, opts.Threshold, stat)...)
+	clusters = append(clusters, cluster(items, Text, opts.TextHash, opts.Threshold, stat)...)
+
+	return clusters
+}
+
+// fingerprint reads the items in parallel, returning the ones that
+// could be read and decoded
+func fingerprint(ctx context.Context, items []*item, opts Options, errs *report.Errors) []*item {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var ok []*item
+	todo := make(chan batch)
+
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for b := range todo {
+				b.read(ctx, opts, func(it *item, err error) {
+					if err != nil {
+						// files that won't decode just aren't compared,
+						// but we do want to hear about ones we can't read
+						var pe *fs.PathError
+						if errors.As(err, &pe) {
+							errs.Add(it.path, report.Hash, err)
+						}
+						return
+					}
+
+					mu.Lock()
+					ok = append(ok, it)
+					mu.Unlock()
+				})
+			}
+		}()
+	}
+
+	for _, b := range batches(items) {
+		if ctx.Err() != nil {
+			break
+		}
+		todo <- b
+	}
+
+	close(todo)
+	wg.Wait()
+	return ok
+}
+
+// batches picks the copy of each item to read and puts the ones inside
+// the same archive together, since opening an archive can mean
+// unpacking all of it
+func batches(items []*item) []batch {
+	var bs []batch
+	inArchive := make(map[string]int) // archive -> its batch
+
+	for _, it := range items {
+		var arch string
+
+		for i, path := range it.paths {
+			a, _, ok := archive.Split(path)
+			if !ok {
+				it.path, arch = path, ""
+				break
+			}
+
+			if i == 0 {
+				it.path, arch = path, a
+			}
+		}
+
+		if arch == "" {
+			bs = append(bs, batch{items: []*item{it}})
+			continue
+		}
+
+		i, seen := inArchive[arch]
+		if !seen {
+			i = len(bs)
+			inArchive[arch] = i
+			bs = append(bs, batch{archive: arch})
+		}
+
+		bs[i].items = append(bs[i].items, it)
+	}
+
+	return bs
+}
+
+// read fingerprints the items of the batch, calling done with each
+func (b batch) read(ctx context.Context, opts Options, done func(*item, error)) {
+	if b.archive == "" {
+		it := b.items[0]
+
+		file, err := os.Open(it.path)
+		if err != nil {
+			done(it, err)
+			return
+		}
+		defer file.Close()
+
+		done(it, it.read(file, opts))
+		return
+	}
+
+	a, err := archive.OpenFS(b.archive)
+	if err != nil {
+		for _, it := range b.items {
+			done(it, err)
+		}
+		return
+	}
+	defer a.Close()
+
+	for _, it := range b.items {
+		if ctx.Err() != nil {
+			return
+		}
+
+		file, err := a.Open(strings.TrimPrefix(it.path, b.archive+archive.Sep))
+		if err != nil {
+			done(it, err)
+			continue
+		}
+
+		err = it.read(file, opts)
+		file.Close()
+		done(it, err)
+	}
+}
+
+func (it *item) read(file io.Reader, opts Options) error {
+	if it.kind == Images {
+		var err error
+		it.hash, err = imageHash(file, opts.ImageHash)
+		return err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxText))
+	if err != nil {
+		return err
+	}
+
+	sh := shingles(string(data))
+	if len(sh) == 0 {
+		return fmt.Errorf("no words")
+	}
+
+	if opts.TextHash == SimHash {
+		it.hash = simHash(sh)
+	} else {
+		it.sig = minHash(sh)
+	}
+
+	return nil
+}
+
+func (it *item) similarity(other *item, method string) float64 {
+	if method == MinHash {
+		return minHashSimilarity(it.sig, other.sig)
+	}
+
+	return bitSimilarity(it.hash, other.hash)
+}
+
+// cluster links every pair of items of the given kind that are similar
+// enough, and returns the connected sets; this compares every pair, which
+// is fine for the thousands of files a photo or document folder holds
+func cluster(all []*item, kind, method string, threshold float64, stat report.StatFunc) []report.Cluster {
+	var items []*item
+	for _, it := range all {
+		if it.kind == kind {
+			items = append(items, it)
+		}
+	}
+
+	parent := make([]int, len(items))
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	// the weakest link in each set, as that's what the threshold is about
+	weakest := make(map[int]float64)
+
+	for i := range items {
+		for j := i + 1; j < len(items); j++ {
+			sim := items[i].similarity(items[j], method)
+			if sim < threshold {
+				continue
+			}
+
+			ri, rj := find(i), find(j)
+			if ri == rj {
+				continue
+			}
+
+			w := min(sim, weakestOf(weakest, ri), weakestOf(weakest, rj))
+
+			parent[rj] = ri
+			weakest[ri] = w
+		}
+	}
+
+	sets := make(map[int][]string)
+	members := make(map[int]int)
+
+	for i, it := range items {
+		r := find(i)
+		sets[r] = append(sets[r], it.paths...)
+		members[r]++
+	}
+
+	var clusters []report.Cluster
+
+	for r, paths := range sets {
+		if members[r] < 2 {
+			continue
+		}
+
+		clusters = append(clusters, report.Cluster{
+			Kind:       kind,
+			Method:     method,
+			Similarity: weakest[r],
+			Files:      report.Stat(paths, stat),
+		})
+	}
+
+	return clusters
+}
+
+func weakestOf(weakest map[int]float64, root int) float64 {
+	if w, ok := weakest[root]; ok {
+		return w
+	}
+	return 1
+}
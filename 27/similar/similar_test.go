@@ -0,0 +1,169 @@
+package similar
+
+import (
+	"archive/zip"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"27/archive"
+	"27/report"
+)
+
+// picture draws a test pattern at any size, so we can check that the
+// hashes don't care about scale or encoding
+func picture(w, h int, flip bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := range h {
+		for x := range w {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			v := uint8(127 + 127*math.Sin(7*fx+2)*math.Cos(5*fy))
+			if flip {
+				v = 255 - v
+			}
+			img.Set(x, y, color.RGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+
+	return img
+}
+
+func save(t *testing.T, path string, img image.Image) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(path, ".png") {
+		err = png.Encode(f, img)
+	} else {
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: 60})
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImageHashes(t *testing.T) {
+	big, small, other := picture(400, 300, false), picture(100, 75, false), picture(400, 300, true)
+
+	for _, st := range []struct {
+		name string
+		hash func(image.Image) uint64
+	}{{AHash, aHash}, {DHash, dHash}} {
+		if sim := bitSimilarity(st.hash(big), st.hash(small)); sim < 0.9 {
+			t.Errorf("%s: resized copy only %.2f similar", st.name, sim)
+		}
+
+		if sim := bitSimilarity(st.hash(big), st.hash(other)); sim > 0.6 {
+			t.Errorf("%s: different picture %.2f similar", st.name, sim)
+		}
+	}
+}
+
+const doc = `It was the best of times, it was the worst of times, it was the age of
+wisdom, it was the age of foolishness, it was the epoch of belief, it was the
+epoch of incredulity, it was the season of Light, it was the season of Darkness,
+it was the spring of hope, it was the winter of despair.`
+
+func TestTextHashes(t *testing.T) {
+	edited := strings.Replace(doc, "winter of despair", "winter of our despair", 1)
+	rewrapped := strings.ReplaceAll(doc, "\n", " ")
+	other := "Call me Ishmael. Some years ago, never mind how long precisely, having little or no money in my purse"
+
+	a, b, c, d := shingles(doc), shingles(edited), shingles(rewrapped), shingles(other)
+
+	if sim := minHashSimilarity(minHash(a), minHash(c)); sim != 1 {
+		t.Errorf("minhash: rewrapped text %.2f similar", sim)
+	}
+
+	if sim := minHashSimilarity(minHash(a), minHash(b)); sim < 0.7 {
+		t.Errorf("minhash: edited text only %.2f similar", sim)
+	}
+
+	if sim := minHashSimilarity(minHash(a), minHash(d)); sim > 0.1 {
+		t.Errorf("minhash: different text %.2f similar", sim)
+	}
+
+	if sim := bitSimilarity(simHash(a), simHash(b)); sim < 0.8 {
+		t.Errorf("simhash: edited text only %.2f similar", sim)
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	p := func(name string) string { return filepath.Join(dir, name) }
+
+	save(t, p("big.png"), picture(400, 300, false))
+	save(t, p("small.jpg"), picture(100, 75, false))
+	save(t, p("other.png"), picture(400, 300, true))
+	os.WriteFile(p("a.txt"), []byte(doc), 0o644)
+	os.WriteFile(p("b.txt"), []byte(doc+" The end."), 0o644)
+	os.WriteFile(p("bad.jpg"), []byte("not really a jpeg"), 0o644)
+
+	hashes := map[string][]string{}
+	for _, name := range []string{"big.png", "small.jpg", "other.png", "a.txt", "b.txt", "bad.jpg"} {
+		hashes[name] = []string{p(name)}
+	}
+
+	opts := Options{Modes: []string{Images, Text}, Threshold: 0.85, ImageHash: DHash, TextHash: MinHash}
+	var errs report.Errors
+	clusters := Find(context.Background(), hashes, opts, os.Stat, &errs)
+
+	if len(clusters) != 2 {
+		t.Fatalf("expected an image and a text cluster, got %+v", clusters)
+	}
+
+	for _, c := range clusters {
+		if len(c.Files) != 2 {
+			t.Errorf("%s: expected 2 files, got %+v", c.Kind, c.Files)
+		}
+	}
+
+	if errs.Len() != 0 {
+		t.Errorf("undecodable files shouldn't be errors: %v", errs.List())
+	}
+}
+
+func TestFindInArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docs.zip")
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zw := zip.NewWriter(f)
+	for name, text := range map[string]string{"a.txt": doc, "b.txt": doc + " The end.", "c.txt": "something else entirely"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(text))
+	}
+	zw.Close()
+	f.Close()
+
+	// the members are read through one opening of the archive
+	hashes := map[string][]string{}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		hashes[name] = []string{path + archive.Sep + name}
+	}
+
+	opts := Options{Modes: []string{Text}, Threshold: 0.85, TextHash: MinHash}
+	var errs report.Errors
+	clusters := Find(context.Background(), hashes, opts, archive.Stat, &errs)
+
+	if len(clusters) != 1 || len(clusters[0].Files) != 2 || errs.Len() != 0 {
+		t.Errorf("expected a.txt and b.txt together, got %+v %v", clusters, errs.List())
+	}
+}
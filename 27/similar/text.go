@@ -0,0 +1,120 @@
+package similar
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"math/rand"
+	"strings"
+	"unicode"
+)
+
+// words in a shingle; three is enough to tell documents apart
+// without a few edits changing most of the shingles
+const shingleSize = 3
+
+// the number of hash functions in a MinHash signature
+const minHashes = 64
+
+// shingles hashes every run of shingleSize words, ignoring case and
+// punctuation, so re-saved or re-wrapped text gives the same set
+func shingles(text string) []uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	if len(words) < shingleSize {
+		if len(words) == 0 {
+			return nil
+		}
+		words = append(words, make([]string, shingleSize-len(words))...)
+	}
+
+	seen := make(map[uint64]bool)
+	var out []uint64
+
+	for i := 0; i+shingleSize <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+shingleSize], " ")))
+
+		if s := h.Sum64(); !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+// the (a, b) pairs for the hash functions a*x + b, fixed so that
+// signatures from different runs can be compared
+var perms = func() [minHashes][2]uint64 {
+	var p [minHashes][2]uint64
+	rnd := rand.New(rand.NewSource(31))
+
+	for i := range p {
+		p[i] = [2]uint64{rnd.Uint64() | 1, rnd.Uint64()}
+	}
+
+	return p
+}()
+
+// minHash keeps the smallest value of each hash function over the
+// shingles; the fraction of equal entries in two signatures estimates
+// the Jaccard similarity of their shingle sets
+func minHash(sh []uint64) []uint64 {
+	sig := make([]uint64, minHashes)
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+
+	for _, s := range sh {
+		for i, p := range perms {
+			if v := p[0]*s + p[1]; v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+
+	return sig
+}
+
+func minHashSimilarity(a, b []uint64) float64 {
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+
+	return float64(same) / float64(len(a))
+}
+
+// simHash adds up the bits of every shingle hash, so similar sets of
+// shingles end up with a small Hamming distance
+func simHash(sh []uint64) uint64 {
+	var weights [64]int
+
+	for _, s := range sh {
+		for i := range weights {
+			if s&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+
+	var h uint64
+	for i, w := range weights {
+		if w > 0 {
+			h |= 1 << i
+		}
+	}
+
+	return h
+}
+
+// bitSimilarity is 1 less the fraction of bits that differ
+func bitSimilarity(a, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
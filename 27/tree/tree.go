@@ -0,0 +1,252 @@
+// Package tree finds whole directories that are duplicated, by giving
+// each directory a Merkle hash over the hashes of what's inside it.
+package tree
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"27/archive"
+	"27/report"
+)
+
+type dir struct {
+	path    string
+	depth   int
+	entries []string // "f name hash", "d name hash", "e name" if empty or "x path" if not hashed
+	subdirs []*dir
+	files   []string
+	hash    string
+}
+
+// Find hashes every directory under root from the files that were
+// hashed in it, and returns the groups of identical directories. A
+// directory's hash covers the names and hashes of its files and
+// subdirectories, so two copies of an album match even if they were
+// made at different times. Anything in it that wasn't hashed, because
+// it was skipped or excluded, keeps it from matching at all, except
+// for empty files and directories, which are all the same. Groups
+// whose directories all sit inside other duplicated directories are
+// left out, as the outer group already says it all.
+func Find[M ~map[string]L, L ~[]string](root string, hashes M, stat report.StatFunc) []report.DirGroup {
+	dirs := build(filepath.Clean(root), hashes)
+
+	for _, d := range dirs {
+		d.entries = append(d.entries, unhashed(d)...)
+	}
+
+	// children before parents
+	all := make([]*dir, 0, len(dirs))
+	for _, d := range dirs {
+		all = append(all, d)
+	}
+	slices.SortFunc(all, func(a, b *dir) int { return b.depth - a.depth })
+
+	byHash := make(map[string][]*dir)
+
+	for _, d := range all {
+		for _, sub := range d.subdirs {
+			d.entries = append(d.entries, fmt.Sprintf("d %s %s", filepath.Base(sub.path), sub.hash))
+		}
+
+		slices.Sort(d.entries)
+		sum := sha256.Sum256([]byte(strings.Join(d.entries, "\n")))
+		d.hash = fmt.Sprintf("%x", sum)
+		byHash[d.hash] = append(byHash[d.hash], d)
+	}
+
+	var groups []report.DirGroup
+
+	for hash, ds := range byHash {
+		if len(ds) < 2 || allInside(ds, dirs) {
+			continue
+		}
+
+		g := report.DirGroup{Hash: hash, Files: len(files(ds[0]))}
+
+		for _, d := range ds {
+			g.Dirs = append(g.Dirs, dirFile(d, stat))
+		}
+
+		slices.SortFunc(g.Dirs, func(a, b report.File) int {
+			return strings.Compare(a.Path, b.Path)
+		})
+
+		groups = append(groups, g)
+	}
+
+	return groups
+}
+
+// build makes a dir for every directory between root and the files
+func build[M ~map[string]L, L ~[]string](root string, hashes M) map[string]*dir {
+	dirs := make(map[string]*dir)
+
+	var get func(path string) *dir
+	get = func(path string) *dir {
+		if d, ok := dirs[path]; ok {
+			return d
+		}
+
+		d := &dir{path: path, depth: strings.Count(path, string(filepath.Separator))}
+		dirs[path] = d
+
+		if parent := filepath.Dir(path); path != root && parent != path {
+			p := get(parent)
+			p.subdirs = append(p.subdirs, d)
+		}
+
+		return d
+	}
+
+	for hash, paths := range hashes {
+		for _, path := range paths {
+			// links we followed can lead out of the tree, and an
+			// archive's members are in the archive, which stands
+			// for them
+			if !within(root, path) {
+				continue
+			}
+			if _, _, ok := archive.Split(path); ok {
+				continue
+			}
+
+			d := get(filepath.Dir(path))
+			d.entries = append(d.entries, fmt.Sprintf("f %s %s", filepath.Base(path), hash))
+			d.files = append(d.files, path)
+		}
+	}
+
+	return dirs
+}
+
+// unhashed lists what's in d besides the files we hashed and the
+// directories they're in: empty ones by name, and anything else by its
+// path, so that d can't match another directory
+func unhashed(d *dir) []string {
+	known := make(map[string]bool)
+	for _, f := range d.files {
+		known[filepath.Base(f)] = true
+	}
+	for _, sub := range d.subdirs {
+		known[filepath.Base(sub.path)] = true
+	}
+
+	list, err := os.ReadDir(d.path)
+	if err != nil {
+		return []string{"x " + d.path}
+	}
+
+	var out []string
+
+	for _, e := range list {
+		if known[e.Name()] {
+			continue
+		}
+
+		path := filepath.Join(d.path, e.Name())
+
+		switch {
+		case e.Type().IsRegular():
+			if info, err := e.Info(); err == nil && info.Size() == 0 {
+				out = append(out, "e "+e.Name())
+				continue
+			}
+		case e.IsDir():
+			if inside, err := os.ReadDir(path); err == nil && len(inside) == 0 {
+				out = append(out, "e "+e.Name()+"/")
+				continue
+			}
+		}
+
+		out = append(out, "x "+path)
+	}
+
+	return out
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// files lists the files hashed anywhere under d
+func files(d *dir) []string {
+	out := slices.Clone(d.files)
+	for _, sub := range d.subdirs {
+		out = append(out, files(sub)...)
+	}
+	return out
+}
+
+// allInside reports whether each directory is in a different copy of
+// the same duplicated directory, whose group already covers them
+func allInside(ds []*dir, dirs map[string]*dir) bool {
+	seen := make(map[string]bool)
+
+	for _, d := range ds {
+		parent, ok := dirs[filepath.Dir(d.path)]
+		if !ok || seen[parent.path] || parent.hash != dirs[filepath.Dir(ds[0].path)].hash {
+			return false
+		}
+		seen[parent.path] = true
+	}
+
+	return true
+}
+
+// dirFile returns the directory's mtime and the total size of its files
+func dirFile(d *dir, stat report.StatFunc) report.File {
+	f := report.File{Path: d.path}
+
+	if info, err := os.Stat(d.path); err == nil {
+		f.ModTime = info.ModTime()
+	}
+
+	for _, file := range report.Stat(files(d), stat) {
+		f.Size += file.Size
+	}
+
+	return f
+}
+
+// Collapse removes the files in all but the first copy of each
+// duplicated directory, so that the per-file report only shows files
+// that are duplicated somewhere other than in a copied directory
+func Collapse[M ~map[string]L, L ~[]string](hashes M, groups []report.DirGroup) M {
+	copies := make(map[string]bool)
+
+	for _, g := range groups {
+		for _, d := range g.Dirs[1:] {
+			copies[d.Path] = true
+		}
+	}
+
+	out := make(M, len(hashes))
+
+	for hash, paths := range hashes {
+		for _, path := range paths {
+			if !inCopy(path, copies) {
+				out[hash] = append(out[hash], path)
+			}
+		}
+	}
+
+	return out
+}
+
+func inCopy(path string, copies map[string]bool) bool {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if copies[dir] {
+			return true
+		}
+
+		if parent := filepath.Dir(dir); parent == dir {
+			return false
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindAndCollapse(t *testing.T) {
+	root := t.TempDir()
+	p := func(name string) string { return filepath.Join(root, name) }
+
+	// the hashes stand in for the file contents
+	files := map[string]string{
+		"album/a.jpg":        "h1",
+		"album/b.jpg":        "h2",
+		"album/sub/c.txt":    "h3",
+		"copy/a.jpg":         "h1",
+		"copy/b.jpg":         "h2",
+		"copy/sub/c.txt":     "h3",
+		"other/sub/c.txt":    "h3",
+		"loose.jpg":          "h1",
+		"renamed/a.jpg":      "h1",
+		"renamed/b-copy.jpg": "h2",
+	}
+
+	hashes := map[string][]string{}
+	for name, hash := range files {
+		os.MkdirAll(filepath.Dir(p(name)), 0o755)
+		os.WriteFile(p(name), []byte(hash), 0o644)
+		hashes[hash] = append(hashes[hash], p(name))
+	}
+
+	groups := Find(root, hashes, os.Stat)
+
+	// album & copy as a whole; album/sub & copy/sub are inside them,
+	// but other/sub isn't, so that group stays
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %+v", groups)
+	}
+
+	for _, g := range groups {
+		switch g.Dirs[0].Path {
+		case p("album"):
+			if len(g.Dirs) != 2 || g.Dirs[1].Path != p("copy") || g.Files != 3 || g.Dirs[0].Size != 6 {
+				t.Errorf("bad album group: %+v", g)
+			}
+		case p("album/sub"):
+			if len(g.Dirs) != 3 {
+				t.Errorf("bad sub group: %+v", g)
+			}
+		default:
+			t.Errorf("unexpected group: %+v", g)
+		}
+	}
+
+	collapsed := Collapse(hashes, groups)
+
+	// copy/ and the other subs are gone, album/ and the rest stay
+	if len(collapsed["h1"]) != 3 || len(collapsed["h2"]) != 2 || len(collapsed["h3"]) != 1 {
+		t.Errorf("bad collapse: %v", collapsed)
+	}
+}
+
+func TestInsideDifferentGroups(t *testing.T) {
+	root := t.TempDir()
+	p := func(name string) string { return filepath.Join(root, name) }
+
+	// x and x2 are copies, and so are y and y2, but they differ from
+	// each other, so no one group holds all four lib directories
+	files := map[string]string{
+		"x/lib/a.go":  "h1",
+		"x/b.txt":     "h2",
+		"x2/lib/a.go": "h1",
+		"x2/b.txt":    "h2",
+		"y/lib/a.go":  "h1",
+		"y/c.txt":     "h3",
+		"y2/lib/a.go": "h1",
+		"y2/c.txt":    "h3",
+	}
+
+	hashes := map[string][]string{}
+	for name, hash := range files {
+		os.MkdirAll(filepath.Dir(p(name)), 0o755)
+		os.WriteFile(p(name), []byte(hash), 0o644)
+		hashes[hash] = append(hashes[hash], p(name))
+	}
+
+	groups := Find(root, hashes, os.Stat)
+
+	if len(groups) != 3 {
+		t.Fatalf("expected x, y and lib groups, got %+v", groups)
+	}
+
+	for _, g := range groups {
+		if g.Dirs[0].Path == p("x/lib") && len(g.Dirs) != 4 {
+			t.Errorf("bad lib group: %+v", g)
+		}
+	}
+}
+
+func TestUnhashed(t *testing.T) {
+	root := t.TempDir()
+	p := func(name string) string { return filepath.Join(root, name) }
+
+	// empty files and directories are all the same, so they're left
+	// out of the hashes but still match
+	files := map[string]string{
+		"album/a.jpg":     "h1",
+		"album/.keep":     "",
+		"copy/a.jpg":      "h1",
+		"copy/.keep":      "",
+		"skipped/a.jpg":   "h1",
+		"skipped/big.raw": "not hashed",
+		"pruned/a.jpg":    "h1",
+		"pruned/tmp/b":    "not hashed",
+	}
+
+	hashes := map[string][]string{}
+	for name, hash := range files {
+		os.MkdirAll(filepath.Dir(p(name)), 0o755)
+		os.WriteFile(p(name), []byte(hash), 0o644)
+		if filepath.Ext(name) == ".jpg" {
+			hashes[hash] = append(hashes[hash], p(name))
+		}
+	}
+	os.Mkdir(p("album/empty"), 0o755)
+	os.Mkdir(p("copy/empty"), 0o755)
+
+	groups := Find(root, hashes, os.Stat)
+
+	if len(groups) != 1 || len(groups[0].Dirs) != 2 || groups[0].Dirs[0].Path != p("album") || groups[0].Dirs[1].Path != p("copy") {
+		t.Errorf("expected only album and copy to match, got %+v", groups)
+	}
+
+	// a directory with something else in it doesn't match any more
+	os.WriteFile(p("copy/notes.txt"), []byte("skipped"), 0o644)
+
+	if groups := Find(root, hashes, os.Stat); len(groups) != 0 {
+		t.Errorf("expected no groups, got %+v", groups)
+	}
+}
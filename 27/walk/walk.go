@@ -0,0 +1,213 @@
+// Package walk finds and hashes the files of a duplicate scan in any
+// fs.FS, so that every finder walks the same way and can be tested
+// without touching the disk.
+package walk
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"27/archive"
+	"27/filter"
+	"27/progress"
+	"27/report"
+)
+
+type Walker struct {
+	fsys fs.FS
+	root string // what paths are reported under, empty for an fs.FS
+	filt *filter.Filter
+	errs *report.Errors
+
+	members archive.Index // the archive members we've hashed
+}
+
+// Sum is the hash of one file
+type Sum struct {
+	Hash string
+	Path string
+	Size int64
+}
+
+// New walks the directory root on disk; the filter should have been
+// made with filter.New for the same root
+func New(root string, filt *filter.Filter, errs *report.Errors) *Walker {
+	return &Walker{fsys: os.DirFS(root), root: filepath.Clean(root), filt: filt, errs: errs}
+}
+
+// NewFS walks a whole fs.FS, with a filter from filter.ForFS
+func NewFS(fsys fs.FS, filt *filter.Filter, errs *report.Errors) *Walker {
+	return &Walker{fsys: fsys, filt: filt, errs: errs}
+}
+
+// Path turns a name in the walk into the path we report
+func (w *Walker) Path(name string) string {
+	if w.root == "" {
+		return name
+	}
+
+	return filepath.Join(w.root, filepath.FromSlash(name))
+}
+
+// Walk calls file for every file to hash under dir, which is "." for
+// the top of the scan. If spawn is set, it's called for every directory
+// instead of walking into it, so that the caller can walk it on its
+// own, maybe concurrently; otherwise Walk goes into subdirectories and
+// followed links itself.
+func (w *Walker) Walk(ctx context.Context, dir string,
+	file func(name string, info fs.FileInfo), spawn func(dir string)) {
+
+	fs.WalkDir(w.fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return fs.SkipAll
+		}
+
+		// record the error and keep going; d may be nil here
+		if err != nil {
+			w.errs.Add(w.Path(name), report.Walk, err)
+			return nil
+		}
+
+		// the root was checked before we started walking it
+		if name == dir {
+			return nil
+		}
+
+		// the entry tells us what it is, so most files and directories
+		// never need a stat of their own
+		act, info, err := w.filt.CheckEntry(w.Path(name), d)
+		if err != nil {
+			op := report.Walk
+			if d.Type()&fs.ModeSymlink != 0 {
+				op = report.Link
+			}
+			w.errs.Add(w.Path(name), op, err)
+			return nil
+		}
+
+		switch act {
+		case filter.Prune:
+			return fs.SkipDir
+		case filter.Descend:
+			if spawn != nil {
+				spawn(name)
+				return fs.SkipDir
+			}
+		case filter.Follow:
+			// WalkDir doesn't follow links, but it does follow its root
+			if spawn != nil {
+				spawn(name)
+			} else {
+				w.Walk(ctx, name, file, nil)
+			}
+		case filter.Hash:
+			file(name, info)
+		}
+
+		return nil
+	})
+}
+
+// Hash returns the sum of a file and the number of bytes read, which
+// are counted by prog if it's set
+func (w *Walker) Hash(name string, prog *progress.Counter) (Sum, int64, error) {
+	file, err := w.fsys.Open(name)
+	if err != nil {
+		return Sum{}, 0, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if prog != nil {
+		r = prog.Reader(file)
+	}
+
+	hash, n, err := sum(r)
+	if err != nil {
+		return Sum{}, n, err
+	}
+
+	return Sum{hash, w.Path(name), n}, n, nil
+}
+
+// Unpacks reports whether the members of a file are to be hashed too
+func (w *Walker) Unpacks(name string) bool {
+	return w.filt.Unpacks(w.Path(name))
+}
+
+// Sums hashes a file the walk found and, if it's an archive to unpack,
+// the members inside it. An archive that -include leaves out is only
+// opened for its members, so it isn't among the sums itself. n is the
+// bytes read from the file, which prog counts; the sums made before an
+// error are returned with it.
+func (w *Walker) Sums(name string, prog *progress.Counter) (sums []Sum, n int64, err error) {
+	if w.filt.Reports(w.Path(name)) {
+		var s Sum
+		if s, n, err = w.Hash(name, prog); err != nil {
+			return nil, n, err
+		}
+		sums = append(sums, s)
+	}
+
+	if w.Unpacks(name) {
+		members, err := w.Members(name)
+		return append(sums, members...), n, err
+	}
+
+	return sums, n, nil
+}
+
+// Members hashes the files inside an archive, as if we had found them
+// on their own
+func (w *Walker) Members(name string) ([]Sum, error) {
+	if w.root == "" {
+		return nil, errors.New("archives can only be opened on disk")
+	}
+
+	var sums []Sum
+
+	err := w.members.Walk(w.Path(name), func(member string, f fs.File, info fs.FileInfo) error {
+		if !w.filt.Member(member, info) {
+			return nil
+		}
+
+		hash, _, err := sum(f)
+		if err != nil {
+			return err
+		}
+
+		sums = append(sums, Sum{hash, member, info.Size()})
+		return nil
+	})
+
+	return sums, err
+}
+
+// Forget drops what the walk remembers about the archive at path, or
+// the archives under it, for a scan that carries on after it's changed
+// or gone
+func (w *Walker) Forget(path string) {
+	w.members.Forget(path)
+}
+
+// Stat is archive.Stat, but doesn't unpack an archive again for the
+// members this walk has hashed
+func (w *Walker) Stat(path string) (fs.FileInfo, error) {
+	return w.members.Stat(path)
+}
+
+func sum(r io.Reader) (string, int64, error) {
+	hash := md5.New() // not secure but fast and good enough
+	n, err := io.Copy(hash, r)
+	if err != nil {
+		return "", n, err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), n, nil
+}
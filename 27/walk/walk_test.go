@@ -0,0 +1,248 @@
+package walk
+
+import (
+	"archive/zip"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"27/filter"
+	"27/report"
+)
+
+// locked refuses to open some names, like a directory we can't read
+type locked struct {
+	fs.FS
+	names []string
+}
+
+func (l locked) Open(name string) (fs.File, error) {
+	if slices.Contains(l.names, name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return l.FS.Open(name)
+}
+
+func file(s string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(s), Mode: 0o644}
+}
+
+// scan hashes everything in fsys, walking subdirectories concurrently
+// if spawn is set, and returns the groups of duplicates
+func scan(t *testing.T, fsys fs.FS, opts filter.Options, spawn bool) (map[string][]string, *report.Errors) {
+	t.Helper()
+
+	filt, err := filter.ForFS(fsys, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errs report.Errors
+	w := NewFS(fsys, filt, &errs)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	hashes := make(map[string][]string)
+
+	add := func(name string, info fs.FileInfo) {
+		s, n, err := w.Hash(name, nil)
+		if err != nil {
+			errs.Add(name, report.Hash, err)
+			return
+		}
+
+		if n != info.Size() {
+			t.Errorf("%s: read %d bytes, expected %d", name, n, info.Size())
+		}
+
+		mu.Lock()
+		hashes[s.Hash] = append(hashes[s.Hash], s.Path)
+		mu.Unlock()
+	}
+
+	var walk func(dir string)
+	walk = func(dir string) {
+		defer wg.Done()
+
+		var sub func(string)
+		if spawn {
+			sub = func(dir string) {
+				wg.Add(1)
+				go walk(dir)
+			}
+		}
+
+		w.Walk(context.Background(), dir, add, sub)
+	}
+
+	wg.Add(1)
+	walk(".")
+	wg.Wait()
+
+	for hash, paths := range hashes {
+		if len(paths) < 2 {
+			delete(hashes, hash)
+			continue
+		}
+		slices.Sort(paths)
+	}
+
+	return hashes, &errs
+}
+
+func groups(hashes map[string][]string) []string {
+	var out []string
+	for _, paths := range hashes {
+		out = append(out, strings.Join(paths, " "))
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestDuplicates(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":         file("hello"),
+		"docs/b.txt":    file("hello"),
+		"docs/c.txt":    file("world"),
+		"docs/old/d":    file("world"),
+		"other/e.txt":   file("unique"),
+		"empty":         file(""),
+		"docs/empty":    file(""),
+		"skip/f.txt":    file("hello"),
+		"docs/notes.md": file("hello"),
+	}
+
+	want := []string{
+		"a.txt docs/b.txt docs/notes.md",
+		"docs/c.txt docs/old/d",
+	}
+
+	for _, spawn := range []bool{false, true} {
+		hashes, errs := scan(t, fsys, filter.Options{Exclude: []string{"skip/"}}, spawn)
+
+		if got := groups(hashes); !slices.Equal(got, want) {
+			t.Errorf("spawn=%v: expected %q, got %q", spawn, want, got)
+		}
+
+		if errs.Len() != 0 {
+			t.Errorf("unexpected errors: %v", errs.List())
+		}
+	}
+
+	hashes, _ := scan(t, fsys, filter.Options{Include: []string{"*.txt"}}, false)
+	want = []string{"a.txt docs/b.txt skip/f.txt"}
+
+	if got := groups(hashes); !slices.Equal(got, want) {
+		t.Errorf("include: expected %q, got %q", want, got)
+	}
+}
+
+func TestPermissionErrors(t *testing.T) {
+	fsys := locked{
+		FS: fstest.MapFS{
+			"a":            file("same"),
+			"secret/b":     file("same"),
+			"public/c":     file("same"),
+			"public/key":   file("same"),
+			"public/other": file("different"),
+		},
+		names: []string{"secret", "public/key"},
+	}
+
+	hashes, errs := scan(t, fsys, filter.Options{}, true)
+
+	want := []string{"a public/c"}
+	if got := groups(hashes); !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	var got []string
+	for _, p := range errs.List() {
+		got = append(got, p.Op+" "+p.Path+" "+p.Kind)
+	}
+	slices.Sort(got)
+
+	if want := []string{"hash public/key permission", "walk secret permission"}; !slices.Equal(got, want) {
+		t.Errorf("expected errors %q, got %q", want, got)
+	}
+}
+
+func TestDeepTree(t *testing.T) {
+	fsys := fstest.MapFS{}
+	dir := ""
+
+	for i := range 200 {
+		dir += "d/"
+		fsys[dir+"leaf"] = file("deep")
+		if i%50 == 0 {
+			fsys[dir+"odd"] = file(dir)
+		}
+	}
+
+	for _, spawn := range []bool{false, true} {
+		hashes, _ := scan(t, fsys, filter.Options{}, spawn)
+
+		if len(hashes) != 1 {
+			t.Fatalf("spawn=%v: expected one group, got %d", spawn, len(hashes))
+		}
+
+		for _, paths := range hashes {
+			if len(paths) != 200 {
+				t.Errorf("spawn=%v: expected 200 copies, got %d", spawn, len(paths))
+			}
+		}
+	}
+}
+
+func TestArchives(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.pdf"), []byte("report"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("report"), 0o644)
+
+	// two copies of a backup, which aren't pdfs themselves
+	for _, name := range []string{"backup.zip", "copy.zip"} {
+		f, _ := os.Create(filepath.Join(dir, name))
+		zw := zip.NewWriter(f)
+		w, _ := zw.Create("docs/a.pdf")
+		w.Write([]byte("report"))
+		zw.Close()
+		f.Close()
+	}
+
+	filt, err := filter.New(dir, filter.Options{Include: []string{"*.pdf"}, Archives: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errs report.Errors
+	w := New(dir, filt, &errs)
+
+	var got []string
+	w.Walk(context.Background(), ".", func(name string, info fs.FileInfo) {
+		sums, _, err := w.Sums(name, nil)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+
+		for _, s := range sums {
+			rel, _ := filepath.Rel(dir, s.Path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+	}, nil)
+	slices.Sort(got)
+
+	want := []string{"a.pdf", "backup.zip!/docs/a.pdf", "copy.zip!/docs/a.pdf"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if info, err := w.Stat(filepath.Join(dir, "copy.zip") + "!/docs/a.pdf"); err != nil || info.Size() != 6 {
+		t.Errorf("stat: %v %v", info, err)
+	}
+}
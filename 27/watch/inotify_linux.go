@@ -0,0 +1,184 @@
+//go:build linux
+
+package watch
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const mask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+
+type Watcher struct {
+	Events chan Event
+	Errors chan error
+
+	file *os.File
+	fd   int
+	mu   sync.Mutex
+	dirs map[int]string // watch descriptor -> directory
+	done chan struct{}
+}
+
+func New() (*Watcher, error) {
+	// non-blocking, so that the runtime poller can wake the reader up
+	// when we close the file
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	w := &Watcher{
+		Events: make(chan Event),
+		Errors: make(chan error),
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		dirs:   make(map[int]string),
+		done:   make(chan struct{}),
+	}
+
+	go w.read()
+	return w, nil
+}
+
+// Add watches one directory; subdirectories need their own Add
+func (w *Watcher) Add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, mask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+
+	w.mu.Lock()
+	w.dirs[wd] = filepath.Clean(dir)
+	w.mu.Unlock()
+
+	return nil
+}
+
+// Remove stops watching dir and the directories under it, e.g. once
+// it's been moved out of the tree, where its events would name paths
+// that aren't there anymore. A directory that was deleted has lost its
+// watches already.
+func (w *Watcher) Remove(dir string) error {
+	dir = filepath.Clean(dir)
+	prefix := dir + string(filepath.Separator)
+
+	w.mu.Lock()
+	var wds []int
+	for wd, d := range w.dirs {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			wds = append(wds, wd)
+			delete(w.dirs, wd)
+		}
+	}
+	w.mu.Unlock()
+
+	var first error
+	for _, wd := range wds {
+		_, err := syscall.InotifyRmWatch(w.fd, uint32(wd))
+		if err != nil && err != syscall.EINVAL && first == nil {
+			first = &os.PathError{Op: "inotify_rm_watch", Path: dir, Err: err}
+		}
+	}
+
+	return first
+}
+
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.file.Close()
+}
+
+func (w *Watcher) read() {
+	defer close(w.Events)
+	defer close(w.Errors)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.send(nil, err)
+			}
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + syscall.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[start:start+int(raw.Len)], "\x00"))
+			off = start + int(raw.Len)
+
+			if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				if !w.send(nil, ErrOverflow) {
+					return
+				}
+				continue
+			}
+
+			w.mu.Lock()
+			dir, ok := w.dirs[int(raw.Wd)]
+			if raw.Mask&syscall.IN_IGNORED != 0 {
+				delete(w.dirs, int(raw.Wd))
+			}
+			w.mu.Unlock()
+
+			if !ok || name == "" {
+				continue
+			}
+
+			ev, ok := convert(raw.Mask, filepath.Join(dir, name))
+			if ok && !w.send(&ev, nil) {
+				return
+			}
+		}
+	}
+}
+
+// convert turns an inotify mask into one of our ops. A new file is
+// only reported once it's been written and closed, so we never hash
+// half a file.
+func convert(m uint32, path string) (Event, bool) {
+	ev := Event{Path: path, Dir: m&syscall.IN_ISDIR != 0}
+
+	switch {
+	case m&syscall.IN_CLOSE_WRITE != 0:
+		ev.Op = Write
+	case m&syscall.IN_MOVED_TO != 0:
+		ev.Op = Create
+	case m&syscall.IN_CREATE != 0 && ev.Dir:
+		ev.Op = Create
+	case m&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+		ev.Op = Remove
+	default:
+		return ev, false
+	}
+
+	return ev, true
+}
+
+func (w *Watcher) send(ev *Event, err error) bool {
+	if ev != nil {
+		select {
+		case w.Events <- *ev:
+			return true
+		case <-w.done:
+			return false
+		}
+	}
+
+	select {
+	case w.Errors <- err:
+		return true
+	case <-w.done:
+		return false
+	}
+}
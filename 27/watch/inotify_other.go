@@ -0,0 +1,20 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+type Watcher struct {
+	Events chan Event
+	Errors chan error
+}
+
+func New() (*Watcher, error) {
+	return nil, errors.New("watching needs inotify, which is only on Linux")
+}
+
+func (w *Watcher) Add(dir string) error { return nil }
+
+func (w *Watcher) Remove(dir string) error { return nil }
+
+func (w *Watcher) Close() error { return nil }
@@ -0,0 +1,36 @@
+// Package watch reports changes to the files in a set of directories,
+// using inotify on Linux.
+package watch
+
+import "errors"
+
+// ErrOverflow is sent on Errors when events were dropped, after which
+// the only way to be sure is to look at everything again
+var ErrOverflow = errors.New("inotify queue overflowed, some changes were missed")
+
+type Op int
+
+const (
+	Create Op = iota // a directory appeared, or a file was moved in
+	Write            // a file was closed after being written
+	Remove           // a file or directory was deleted or moved out
+)
+
+func (op Op) String() string {
+	switch op {
+	case Create:
+		return "create"
+	case Write:
+		return "write"
+	case Remove:
+		return "remove"
+	}
+
+	return "unknown"
+}
+
+type Event struct {
+	Path string
+	Op   Op
+	Dir  bool
+}
@@ -0,0 +1,99 @@
+//go:build linux
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func next(t *testing.T, w *Watcher) Event {
+	t.Helper()
+
+	select {
+	case ev := <-w.Events:
+		return ev
+	case err := <-w.Errors:
+		t.Fatal(err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event")
+	}
+
+	return Event{}
+}
+
+func TestEvents(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := w.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "a")
+	os.WriteFile(file, []byte("x"), 0o644)
+
+	if ev := next(t, w); ev.Op != Write || ev.Path != file {
+		t.Errorf("expected write of %s, got %+v", file, ev)
+	}
+
+	sub := filepath.Join(dir, "sub")
+	os.Mkdir(sub, 0o755)
+
+	if ev := next(t, w); ev.Op != Create || !ev.Dir || ev.Path != sub {
+		t.Errorf("expected new dir %s, got %+v", sub, ev)
+	}
+
+	os.Remove(file)
+
+	if ev := next(t, w); ev.Op != Remove || ev.Path != file {
+		t.Errorf("expected removal of %s, got %+v", file, ev)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	dir, away := t.TempDir(), t.TempDir()
+
+	w, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	sub := filepath.Join(dir, "sub")
+	os.MkdirAll(filepath.Join(sub, "deeper"), 0o755)
+
+	for _, d := range []string{dir, sub, filepath.Join(sub, "deeper")} {
+		if err := w.Add(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moved := filepath.Join(away, "sub")
+	os.Rename(sub, moved)
+
+	ev := next(t, w)
+	if ev.Op != Remove || !ev.Dir || ev.Path != sub {
+		t.Fatalf("expected %s moved out, got %+v", sub, ev)
+	}
+
+	if err := w.Remove(ev.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing more is heard from it or what's in it
+	os.WriteFile(filepath.Join(moved, "a"), []byte("x"), 0o644)
+	os.WriteFile(filepath.Join(moved, "deeper", "b"), []byte("x"), 0o644)
+	os.WriteFile(filepath.Join(dir, "c"), []byte("x"), 0o644)
+
+	if ev := next(t, w); ev.Path != filepath.Join(dir, "c") {
+		t.Errorf("unexpected event %+v", ev)
+	}
+}
@@ -0,0 +1,3 @@
+module leaktest
+
+go 1.23
@@ -0,0 +1,94 @@
+// Package leaktest fails a test that leaves goroutines running after
+// it's done.
+//
+//	func TestSomething(t *testing.T) {
+//		leaktest.Check(t)
+//		...
+//	}
+//
+// Every goroutine that wasn't running when Check was called counts, so
+// it can't tell one parallel test's goroutines from another's.
+package leaktest
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Wait is how long goroutines get to finish after the test, as they
+// may still be on their way out, e.g. after a cancel
+var Wait = 5 * time.Second
+
+type goroutine struct {
+	id    string
+	stack string
+}
+
+// Check notes which goroutines are running, and fails t with the stacks
+// of any others still running once it and its cleanups are done; call
+// it first, so its own cleanup runs last
+func Check(t testing.TB) {
+	t.Helper()
+
+	before := make(map[string]bool)
+	for _, g := range goroutines() {
+		before[g.id] = true
+	}
+
+	t.Cleanup(func() {
+		var leaked []goroutine
+		deadline := time.Now().Add(Wait)
+
+		for pause := time.Millisecond; ; pause = min(2*pause, 100*time.Millisecond) {
+			leaked = leaked[:0]
+			for _, g := range goroutines() {
+				if !before[g.id] {
+					leaked = append(leaked, g)
+				}
+			}
+
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(pause)
+		}
+
+		if len(leaked) == 0 {
+			return
+		}
+
+		var b strings.Builder
+		for _, g := range leaked {
+			b.WriteString("\n\n")
+			b.WriteString(g.stack)
+		}
+		t.Errorf("%d goroutines still running after %s:%s", len(leaked), Wait, b.String())
+	})
+}
+
+// goroutines are the stacks of all of them, as runtime.Stack prints
+// them: "goroutine 7 [chan receive]:" and then the calls, with a blank
+// line between each; ids aren't used again
+func goroutines() []goroutine {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var all []goroutine
+	for _, stack := range strings.Split(strings.TrimSpace(string(buf)), "\n\n") {
+		id, _, ok := strings.Cut(strings.TrimPrefix(stack, "goroutine "), " ")
+		if ok {
+			all = append(all, goroutine{id, stack})
+		}
+	}
+
+	return all
+}
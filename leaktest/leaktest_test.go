@@ -0,0 +1,78 @@
+package leaktest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fake stands in for a test, to see if Check fails it
+type fake struct {
+	testing.TB
+	cleanups []func()
+	failure  string
+}
+
+func (f *fake) Helper() {}
+
+func (f *fake) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func (f *fake) Errorf(format string, args ...any) {
+	f.failure = fmt.Sprintf(format, args...)
+}
+
+func (f *fake) done() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func block(ch chan int) {
+	<-ch
+}
+
+func TestCheck(t *testing.T) {
+	defer func(wait time.Duration) { Wait = wait }(Wait)
+	Wait = 50 * time.Millisecond
+
+	// one that's still blocked is reported with its stack
+	f := &fake{}
+	Check(f)
+
+	ch := make(chan int)
+	go block(ch)
+	f.done()
+
+	if !strings.HasPrefix(f.failure, "1 goroutines still running") || !strings.Contains(f.failure, "leaktest.block(") {
+		t.Errorf("expected block to be reported, got %q", f.failure)
+	}
+
+	close(ch)
+
+	// one on its way out is waited for
+	f = &fake{}
+	Check(f)
+
+	go time.Sleep(20 * time.Millisecond)
+	f.done()
+
+	if f.failure != "" {
+		t.Errorf("expected nothing left, got %q", f.failure)
+	}
+
+	// and ones started before don't count
+	ch = make(chan int)
+	defer close(ch)
+	go block(ch)
+
+	f = &fake{}
+	Check(f)
+	f.done()
+
+	if f.failure != "" {
+		t.Errorf("expected nothing left, got %q", f.failure)
+	}
+}